@@ -1,98 +1,558 @@
 package core
 
 import (
+	"context"
 	"errors"
+	"fmt"
 	"io/ioutil"
+	"math"
+	"math/big"
+	"net/http"
 	"os"
+	goruntime "runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync/atomic"
 	"time"
 
-	"github.com/benbjohnson/immutable"
 	"github.com/dball/glimpse/printer"
 	"github.com/dball/glimpse/reader"
 	"github.com/dball/glimpse/runtime"
 	"github.com/dball/glimpse/types"
 )
 
-func intList(items []types.MalType) ([]int64, error) {
-	var ints []int64
-	for _, item := range items {
-		i, valid := item.(types.Integer)
-		if !valid {
-			return ints, errors.New("non-integer found")
+// integerOp is an arithmetic operation on integers, computed in int64s
+// unless that overflows, and in big integers otherwise
+type integerOp struct {
+	small func(a, b int64) (int64, bool)
+	big   func(z, a, b *big.Int) *big.Int
+}
+
+var (
+	addOp = integerOp{
+		small: func(a, b int64) (int64, bool) {
+			sum := a + b
+			return sum, (sum > a) == (b > 0)
+		},
+		big: (*big.Int).Add,
+	}
+	subtractOp = integerOp{
+		small: func(a, b int64) (int64, bool) {
+			difference := a - b
+			return difference, (difference < a) == (b > 0)
+		},
+		big: (*big.Int).Sub,
+	}
+	multiplyOp = integerOp{
+		small: func(a, b int64) (int64, bool) {
+			if a == 0 || b == 0 {
+				return 0, true
+			}
+			product := a * b
+			return product, product/b == a && !(a == -1 && b == math.MinInt64) && !(b == -1 && a == math.MinInt64)
+		},
+		big: (*big.Int).Mul,
+	}
+	divideOp = integerOp{
+		small: func(a, b int64) (int64, bool) {
+			return a / b, !(a == math.MinInt64 && b == -1)
+		},
+		big: (*big.Int).Quo,
+	}
+)
+
+// apply applies the op to integer values, promoting the result to a bigint
+// if it overflows
+func (op integerOp) apply(this, that types.MalType) (types.MalType, error) {
+	if a, valid := this.(types.Integer); valid {
+		if b, valid := that.(types.Integer); valid {
+			if result, ok := op.small(int64(a), int64(b)); ok {
+				return types.Integer(result), nil
+			}
+		}
+	}
+	a, valid := types.AsBigInt(this)
+	if !valid {
+		return nil, errors.New("non-integer found")
+	}
+	b, valid := types.AsBigInt(that)
+	if !valid {
+		return nil, errors.New("non-integer found")
+	}
+	return types.NewInteger(op.big(new(big.Int), a, b)), nil
+}
+
+// fold applies the op to an initial value and each arg in turn
+func (op integerOp) fold(acc types.MalType, args []types.MalType) (types.MalType, error) {
+	for _, arg := range args {
+		var err error
+		acc, err = op.apply(acc, arg)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return acc, nil
+}
+
+// integerArg checks that the named builtin's arg is an integer
+func integerArg(name string, value types.MalType) (types.MalType, error) {
+	switch value.(type) {
+	case types.Integer, types.BigInt:
+		return value, nil
+	default:
+		return nil, errors.New(name + " requires an integer arg")
+	}
+}
+
+// compareWith compares two values using a comparator fn, or types.Compare if
+// it is nil. Comparators may return an integer or a boolean less-than result.
+func compareWith(comparator *types.Function, this, that types.MalType) (int8, error) {
+	if comparator == nil {
+		return types.Compare(this, that)
+	}
+	result, err := comparator.Fn(this, that)
+	if err != nil {
+		return 0, err
+	}
+	switch v := result.(type) {
+	case types.Integer:
+		if v < 0 {
+			return -1, nil
+		} else if v > 0 {
+			return 1, nil
+		}
+		return 0, nil
+	case types.Boolean:
+		if v {
+			return -1, nil
+		}
+		less, err := comparator.Fn(that, this)
+		if err != nil {
+			return 0, err
+		}
+		if less == types.Boolean(true) {
+			return 1, nil
+		}
+		return 0, nil
+	default:
+		return 0, errors.New("comparator must return an integer or boolean")
+	}
+}
+
+// sortStable sorts items by their keys, preserving the order of equal keys
+func sortStable(items []types.MalType, keys []types.MalType, comparator *types.Function) (types.MalType, error) {
+	indexes := make([]int, len(items))
+	for i := range indexes {
+		indexes[i] = i
+	}
+	var err error
+	sort.SliceStable(indexes, func(i, j int) bool {
+		if err != nil {
+			return false
+		}
+		comp, cerr := compareWith(comparator, keys[indexes[i]], keys[indexes[j]])
+		if cerr != nil {
+			err = cerr
+			return false
+		}
+		return comp < 0
+	})
+	if err != nil {
+		return nil, err
+	}
+	sorted := make([]types.MalType, len(items))
+	for i, index := range indexes {
+		sorted[i] = items[index]
+	}
+	return types.NewList(sorted...), nil
+}
+
+// extreme returns the arg which compares in the given direction to all others
+func extreme(name string, direction int8, args []types.MalType) (types.MalType, error) {
+	if len(args) == 0 {
+		return nil, errors.New(name + " requires at least one arg")
+	}
+	result := args[0]
+	if len(args) == 1 {
+		if _, err := types.Compare(result, result); err != nil {
+			return nil, err
+		}
+	}
+	for _, arg := range args[1:] {
+		comp, err := types.Compare(arg, result)
+		if err != nil {
+			return nil, err
+		}
+		if comp == direction {
+			result = arg
+		}
+	}
+	return result, nil
+}
+
+// stringFn builds a fn of one string arg to a transformed string
+func stringFn(name string, transform func(string) string) types.Function {
+	return types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New(name + " requires 1 arg")
+			}
+			s, valid := args[0].(types.String)
+			if !valid {
+				return nil, errors.New(name + " requires a string arg")
+			}
+			return types.String(transform(string(s))), nil
+		},
+	}
+}
+
+// stringPredicate builds a fn of two string args to a boolean
+func stringPredicate(name string, pred func(string, string) bool) types.Function {
+	return types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New(name + " requires 2 args")
+			}
+			s, valid := args[0].(types.String)
+			if !valid {
+				return nil, errors.New(name + " requires a string arg")
+			}
+			substr, valid := args[1].(types.String)
+			if !valid {
+				return nil, errors.New(name + " requires a string arg")
+			}
+			return types.Boolean(pred(string(s), string(substr))), nil
+		},
+	}
+}
+
+// format formats args into a string with %s, %d, %v, and %% directives
+func format(f string, args []types.MalType) (string, error) {
+	var sb strings.Builder
+	runes := []rune(f)
+	n := 0
+	for i := 0; i < len(runes); i++ {
+		if runes[i] != '%' {
+			sb.WriteRune(runes[i])
+			continue
+		}
+		i++
+		if i == len(runes) {
+			return "", errors.New("format string ends with an incomplete directive")
+		}
+		directive := runes[i]
+		if directive == '%' {
+			sb.WriteRune('%')
+			continue
+		}
+		if n == len(args) {
+			return "", errors.New("format has too few args")
+		}
+		arg := args[n]
+		n++
+		switch directive {
+		case 's':
+			sb.WriteString(printer.PrintStr(printer.Config{Readably: false}, arg))
+		case 'v':
+			sb.WriteString(printer.PrintStr(printer.Config{Readably: true}, arg))
+		case 'd':
+			switch arg.(type) {
+			case types.Integer, types.BigInt:
+				sb.WriteString(printer.PrintStr(printer.Config{}, arg))
+			default:
+				return "", errors.New("format %d requires an integer arg")
+			}
+		default:
+			return "", errors.New("format has an invalid directive: %" + string(directive))
+		}
+	}
+	if n != len(args) {
+		return "", errors.New("format has too many args")
+	}
+	return sb.String(), nil
+}
+
+// swap applies a fn to the current value of an atom and any extra args,
+// sets the atom to the result, and returns the old and new values
+func swap(name string, args []types.MalType) (types.MalType, types.MalType, error) {
+	if len(args) < 2 {
+		return nil, nil, errors.New(name + " requires at least 2 args")
+	}
+	atom, valid := args[0].(*types.Atom)
+	if !valid {
+		return nil, nil, errors.New(name + " requires an atom value")
+	}
+	fn, err := fnArg(name, args[1])
+	if err != nil {
+		return nil, nil, err
+	}
+	return atom.Swap(func(old types.MalType) (types.MalType, error) {
+		return fn.Fn(append([]types.MalType{old}, args[2:]...)...)
+	})
+}
+
+// update applies a fn to the value at a path of keys through nested maps,
+// followed by any extra args, and associates the result at the path
+func update(name string, m types.MalType, path types.MalType, f types.MalType, extra []types.MalType) (types.MalType, error) {
+	fn, err := fnArg(name, f)
+	if err != nil {
+		return nil, err
+	}
+	old, err := runtime.GetIn(m, path, types.Nil{})
+	if err != nil {
+		return nil, err
+	}
+	value, err := fn.Fn(append([]types.MalType{old}, extra...)...)
+	if err != nil {
+		return nil, err
+	}
+	return runtime.AssocIn(m, path, value)
+}
+
+// PrintConfig builds the printer config for the print vars bound in an env,
+// *print-length*, *print-level*, and *print-readably*, which applies only if
+// readably is true. Builtins read them from the env they were built in, not
+// their callers', so the vars are set with def!; let* only shadows them
+// lexically, as there are no dynamic bindings yet.
+func PrintConfig(env *types.Env, readably bool) printer.Config {
+	config := printer.Config{Readably: readably}
+	if readably {
+		if value, err := env.Get("*print-readably*"); err == nil {
+			config.Readably = runtime.Truthy(value)
+		}
+	}
+	if length, err := env.Get("*print-length*"); err == nil {
+		if n, valid := length.(types.Integer); valid {
+			config.MaxSeqLength = int(n)
+		}
+	}
+	if level, err := env.Get("*print-level*"); err == nil {
+		if n, valid := level.(types.Integer); valid {
+			config.MaxDepth = int(n)
+		}
+	}
+	return config
+}
+
+// ReaderOptions builds the reader options for the reader vars bound in an
+// env: *read-eval* allows #= forms, and *read-bigints* reads integer literals
+// beyond the range of integers as bigints
+func ReaderOptions(env *types.Env) reader.Options {
+	var options reader.Options
+	if value, err := env.Get("*read-eval*"); err == nil {
+		options.ReadEval = runtime.Truthy(value)
+	}
+	if value, err := env.Get("*read-bigints*"); err == nil {
+		options.PromoteIntegers = runtime.Truthy(value)
+	}
+	return options
+}
+
+// slurpTimeout bounds the time slurp waits for a url's response
+var slurpTimeout = 30 * time.Second
+
+// slurp reads the contents of stdin if the source is -, of a url if it is an
+// http or https url, and of the named file otherwise
+func slurp(source string) ([]byte, error) {
+	switch {
+	case source == "-":
+		return ioutil.ReadAll(os.Stdin)
+	case strings.HasPrefix(source, "http://"), strings.HasPrefix(source, "https://"):
+		ctx, cancel := context.WithTimeout(context.Background(), slurpTimeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, source, nil)
+		if err != nil {
+			return nil, err
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		defer resp.Body.Close()
+		if resp.StatusCode >= 400 {
+			return nil, fmt.Errorf("slurp of %s failed: %s", source, resp.Status)
+		}
+		return ioutil.ReadAll(resp.Body)
+	default:
+		return ioutil.ReadFile(source)
+	}
+}
+
+// metaMap returns the metadata map for a value, which must be a map or nil
+func metaMap(name string, value types.MalType) (types.Map, error) {
+	switch v := value.(type) {
+	case types.Map:
+		return v, nil
+	case types.Nil:
+		return types.Map{}, nil
+	default:
+		return types.Map{}, errors.New(name + " requires map or nil metadata")
+	}
+}
+
+// errMacroValue is returned when a macro is passed where a fn is required
+var errMacroValue = errors.New("can't take value of a macro")
+
+// fnArg checks that the named builtin's arg is a fn and not a macro
+func fnArg(name string, value types.MalType) (types.Function, error) {
+	fn, valid := value.(types.Function)
+	if !valid {
+		return types.Function{}, errors.New(name + " requires a fn value")
+	}
+	if fn.IsMacro {
+		return types.Function{}, errMacroValue
+	}
+	return fn, nil
+}
+
+// allEqual is true if all the values are equal to the first
+func allEqual(values []types.MalType) bool {
+	for i := 1; i < len(values); i++ {
+		if !types.Equals(values[0], values[i]) {
+			return false
 		}
-		ints = append(ints, int64(i))
 	}
-	return ints, nil
+	return true
+}
+
+// arrayIndex validates an array and an index within its bounds
+func arrayIndex(name string, array types.MalType, index types.MalType) (*types.MutableArray, int, error) {
+	a, valid := array.(*types.MutableArray)
+	if !valid {
+		return nil, 0, errors.New(name + " requires an array")
+	}
+	i, valid := index.(types.Integer)
+	if !valid {
+		return nil, 0, errors.New(name + " requires an integer index")
+	}
+	if i < 0 || int(i) >= len(a.Items) {
+		return nil, 0, errors.New(name + " index out of bounds")
+	}
+	return a, int(i), nil
+}
+
+// epoch is the origin of nano-time
+var epoch = time.Now()
+
+// gensyms counts the symbols generated by gensym across all envs
+var gensyms int64
+
+// Gensym returns a new symbol with the given prefix, unique across all envs
+func Gensym(prefix string) types.Symbol {
+	id := atomic.AddInt64(&gensyms, 1)
+	return types.NewSymbol(prefix + strconv.FormatInt(id, 10))
+}
+
+// Options configure the environment built for an interpreter
+type Options struct {
+	// Progress, if set, is called periodically by eager traversals of long
+	// seqs, e.g. map and reduce, with the number of items traversed so far
+	Progress func(count int)
+	// Context, if set, returns the context of the current evaluation, whose
+	// cancellation interrupts derefs waiting on promises and futures
+	Context func() context.Context
 }
 
 // BuildEnv builds and returns a new environment with core vars
 func BuildEnv() *types.Env {
+	return BuildEnvWithOptions(Options{})
+}
+
+// BuildEnvWithOptions builds and returns a new environment with core vars
+// and the given options
+func BuildEnvWithOptions(options Options) *types.Env {
 	var env = types.BuildEnv()
-	env.Set("+", types.Function{
+	env.Set("*read-eval*", types.Boolean(false))
+	env.Set("*read-bigints*", types.Boolean(false))
+	env.Set("*print-length*", types.Nil{})
+	env.Set("*print-level*", types.Nil{})
+	env.Set("*print-readably*", types.Boolean(true))
+	env.SetFn("+", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			ints, err := intList(args)
-			if err != nil {
-				return nil, err
+			return addOp.fold(types.Integer(0), args)
+		},
+	})
+	env.SetFn("-", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) == 0 {
+				return nil, errors.New("- requires at least one arg")
 			}
-			var sum int64 = 0
-			for _, i := range ints {
-				sum += i
+			if len(args) == 1 {
+				return subtractOp.apply(types.Integer(0), args[0])
 			}
-			return types.Integer(sum), nil
+			return subtractOp.fold(args[0], args[1:])
 		},
 	})
-	env.Set("-", types.Function{
+	env.SetFn("*", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			ints, err := intList(args)
-			if err != nil {
-				return nil, err
+			return multiplyOp.fold(types.Integer(1), args)
+		},
+	})
+	env.SetFn("/", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) == 0 {
+				return nil, errors.New("/ requires at least one arg")
 			}
-			if len(ints) == 1 {
-				return -ints[0], nil
+			for _, arg := range args[1:] {
+				if arg == types.Integer(0) {
+					return nil, errors.New("/ by zero")
+				}
 			}
-			var sum int64 = ints[0]
-			for _, i := range ints[1:] {
-				sum -= i
+			if len(args) == 1 {
+				if args[0] == types.Integer(0) {
+					return nil, errors.New("/ by zero")
+				}
+				return divideOp.apply(types.Integer(1), args[0])
 			}
-			return types.Integer(sum), nil
+			return divideOp.fold(args[0], args[1:])
 		},
 	})
-	env.Set("*", types.Function{
+	env.SetFn("inc", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			ints, err := intList(args)
+			if len(args) != 1 {
+				return nil, errors.New("inc requires 1 arg")
+			}
+			i, err := integerArg("inc", args[0])
 			if err != nil {
 				return nil, err
 			}
-			var sum int64 = 1
-			for _, i := range ints {
-				sum *= i
-			}
-			return types.Integer(sum), nil
+			return addOp.apply(i, types.Integer(1))
 		},
 	})
-	env.Set("/", types.Function{
+	env.SetFn("dec", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			ints, err := intList(args)
+			if len(args) != 1 {
+				return nil, errors.New("dec requires 1 arg")
+			}
+			i, err := integerArg("dec", args[0])
 			if err != nil {
 				return nil, err
 			}
-			if len(ints) == 1 {
-				return types.Integer(1 / ints[0]), nil
+			return subtractOp.apply(i, types.Integer(1))
+		},
+	})
+	env.SetFn("abs", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("abs requires 1 arg")
+			}
+			i, err := integerArg("abs", args[0])
+			if err != nil {
+				return nil, err
 			}
-			var sum int64 = ints[0]
-			for _, i := range ints[1:] {
-				sum /= i
+			if comp, _ := types.Compare(i, types.Integer(0)); comp < 0 {
+				return subtractOp.apply(types.Integer(0), i)
 			}
-			return types.Integer(sum), nil
+			return i, nil
 		},
 	})
-	env.Set("list", types.Function{
+	env.SetFn("list", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			return types.NewList(args...), nil
 		},
 	})
-	env.Set("list?", types.Function{
+	env.SetFn("list?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			if len(args) != 1 {
 				return nil, errors.New("list? requires 1 arg")
@@ -101,7 +561,7 @@ func BuildEnv() *types.Env {
 			return types.Boolean(valid), nil
 		},
 	})
-	env.Set("empty?", types.Function{
+	env.SetFn("empty?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			if len(args) != 1 {
 				return nil, errors.New("empty? requires 1 arg")
@@ -109,7 +569,7 @@ func BuildEnv() *types.Env {
 			return runtime.Empty(args[0])
 		},
 	})
-	env.Set("count", types.Function{
+	env.SetFn("count", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			if len(args) != 1 {
 				return nil, errors.New("count requires 1 arg")
@@ -125,21 +585,33 @@ func BuildEnv() *types.Env {
 			return types.Integer(count), nil
 		},
 	})
-	env.Set("=", types.Function{
+	env.SetFn("=", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			if len(args) == 0 {
-				return types.Boolean(true), nil
+			return types.Boolean(allEqual(args)), nil
+		},
+	})
+	env.SetFn("not=", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			return types.Boolean(!allEqual(args)), nil
+		},
+	})
+	env.SetFn("boolean", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("boolean requires 1 arg")
 			}
-			this := args[0]
-			for _, that := range args[1:] {
-				if !types.Equals(this, that) {
-					return types.Boolean(false), nil
-				}
+			return types.Boolean(runtime.Truthy(args[0])), nil
+		},
+	})
+	env.SetFn("not", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("not requires 1 arg")
 			}
-			return types.Boolean(true), nil
+			return types.Boolean(!runtime.Truthy(args[0])), nil
 		},
 	})
-	env.Set(">=", types.Function{
+	env.SetFn(">=", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			if len(args) == 0 {
 				return nil, errors.New(">= requires at least one arg")
@@ -159,7 +631,7 @@ func BuildEnv() *types.Env {
 			return types.Boolean(true), nil
 		},
 	})
-	env.Set(">", types.Function{
+	env.SetFn(">", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			if len(args) == 0 {
 				return nil, errors.New("> requires at least one arg")
@@ -181,7 +653,7 @@ func BuildEnv() *types.Env {
 			return types.Boolean(true), nil
 		},
 	})
-	env.Set("<=", types.Function{
+	env.SetFn("<=", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			if len(args) == 0 {
 				return nil, errors.New("<= requires at least one arg")
@@ -201,7 +673,7 @@ func BuildEnv() *types.Env {
 			return types.Boolean(true), nil
 		},
 	})
-	env.Set("<", types.Function{
+	env.SetFn("<", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			if len(args) == 0 {
 				return nil, errors.New("< requires at least one arg")
@@ -223,151 +695,542 @@ func BuildEnv() *types.Env {
 			return types.Boolean(true), nil
 		},
 	})
-	env.Set("pr-str", types.Function{
+	env.SetFn("max", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			var sb strings.Builder
-			for i, arg := range args {
-				if i > 0 {
-					sb.WriteRune(' ')
-				}
-				sb.WriteString(printer.PrintStr(printer.Config{Readably: true}, arg))
-			}
-			return types.String(sb.String()), nil
+			return extreme("max", 1, args)
 		},
 	})
-	env.Set("str", types.Function{
+	env.SetFn("min", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			var sb strings.Builder
-			for _, arg := range args {
-				sb.WriteString(printer.PrintStr(printer.Config{Readably: false}, arg))
-			}
-			return types.String(sb.String()), nil
+			return extreme("min", -1, args)
 		},
 	})
-	env.Set("prn", types.Function{
+	env.SetFn("pr-str", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			var sb strings.Builder
 			for i, arg := range args {
 				if i > 0 {
 					sb.WriteRune(' ')
 				}
-				sb.WriteString(printer.PrintStr(printer.Config{Readably: true}, arg))
+				sb.WriteString(printer.PrintStr(PrintConfig(env, true), arg))
 			}
-			sb.WriteRune('\n')
-			os.Stdout.WriteString(sb.String())
-			return types.Nil{}, nil
+			return types.String(sb.String()), nil
 		},
 	})
-	env.Set("println", types.Function{
+	env.SetFn("str", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			var sb strings.Builder
-			for i, arg := range args {
-				if i > 0 {
-					sb.WriteRune(' ')
-				}
+			for _, arg := range args {
 				sb.WriteString(printer.PrintStr(printer.Config{Readably: false}, arg))
 			}
-			sb.WriteRune('\n')
-			os.Stdout.WriteString(sb.String())
-			return types.Nil{}, nil
+			return types.String(sb.String()), nil
 		},
 	})
-	env.Set("read-string", types.Function{
+	env.SetFn("make-array", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			if len(args) != 1 {
-				return nil, errors.New("read-string requires one arg")
+				return nil, errors.New("make-array requires 1 arg")
 			}
-			s, valid := args[0].(types.String)
-			if !valid {
-				return nil, errors.New("read-string requires a string arg")
+			n, valid := args[0].(types.Integer)
+			if !valid || n < 0 {
+				return nil, errors.New("make-array requires a non-negative integer size")
 			}
-			return reader.ReadStr(string(s))
+			return types.NewMutableArray(int(n)), nil
 		},
 	})
-	env.Set("slurp", types.Function{
+	env.SetFn("aget", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			if len(args) != 1 {
-				return nil, errors.New("read-string requires one arg")
-			}
-			s, valid := args[0].(types.String)
-			if !valid {
-				return nil, errors.New("read-string requires a string arg")
+			if len(args) != 2 {
+				return nil, errors.New("aget requires 2 args")
 			}
-			bytes, err := ioutil.ReadFile(string(s))
+			a, i, err := arrayIndex("aget", args[0], args[1])
 			if err != nil {
 				return nil, err
 			}
-			return types.String(string(bytes)), nil
+			return a.Items[i], nil
 		},
 	})
-	env.Set("atom", types.Function{
+	env.SetFn("aset", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			// TODO validate one value
-			return &types.Atom{Value: args[0]}, nil
+			if len(args) != 3 {
+				return nil, errors.New("aset requires 3 args")
+			}
+			a, i, err := arrayIndex("aset", args[0], args[1])
+			if err != nil {
+				return nil, err
+			}
+			a.Items[i] = args[2]
+			return args[2], nil
 		},
 	})
-	env.Set("atom?", types.Function{
+	env.SetFn("string-builder", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			// TODO validate one value
-			_, valid := args[0].(*types.Atom)
-			return types.Boolean(valid), nil
+			if len(args) != 0 {
+				return nil, errors.New("string-builder requires 0 args")
+			}
+			return types.NewStringBuilder(), nil
 		},
 	})
-	env.Set("deref", types.Function{
+	env.SetFn("append!", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			// TODO validate one value
-			atom, valid := args[0].(*types.Atom)
+			if len(args) < 1 {
+				return nil, errors.New("append! requires at least 1 arg")
+			}
+			sb, valid := args[0].(*types.StringBuilder)
 			if !valid {
-				return nil, errors.New("deref requires an atom value")
+				return nil, errors.New("append! requires a string builder")
 			}
-			return atom.Value, nil
+			for _, arg := range args[1:] {
+				if err := printer.Fprint(sb, printer.Config{Readably: false}, arg); err != nil {
+					return nil, err
+				}
+			}
+			return sb, nil
 		},
 	})
-	env.Set("reset!", types.Function{
+	env.SetFn("to-string", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			// TODO validate two value
-			atom, valid := args[0].(*types.Atom)
+			if len(args) != 1 {
+				return nil, errors.New("to-string requires 1 arg")
+			}
+			sb, valid := args[0].(*types.StringBuilder)
 			if !valid {
-				return nil, errors.New("deref requires an atom value")
+				return nil, errors.New("to-string requires a string builder")
 			}
-			value := args[1]
-			atom.Set(value)
-			return value, nil
+			return types.String(sb.String()), nil
 		},
 	})
-	env.Set("swap!", types.Function{
+	env.SetFn("join", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			// TODO validate
-			atom, valid := args[0].(*types.Atom)
+			if len(args) != 2 {
+				return nil, errors.New("join requires 2 args")
+			}
+			sep, valid := args[0].(types.String)
 			if !valid {
-				return nil, errors.New("swap! requires atom value")
+				return nil, errors.New("join requires a string separator")
 			}
-			fn, valid := args[1].(types.Function)
-			swapArgs := []types.MalType{atom.Value}
-			if len(args) > 2 {
-				swapArgs = append(swapArgs, args[2:]...)
+			items, err := runtime.IntoSlice(args[1])
+			if err != nil {
+				return nil, err
 			}
-			value, error := fn.Fn(swapArgs...)
-			if error != nil {
-				return nil, error
+			var sb strings.Builder
+			for i, item := range items {
+				if i > 0 {
+					sb.WriteString(string(sep))
+				}
+				sb.WriteString(printer.PrintStr(printer.Config{Readably: false}, item))
 			}
-			atom.Set(value)
-			return value, nil
+			return types.String(sb.String()), nil
 		},
 	})
-	env.Set("seq", types.Function{
+	env.SetFn("subs", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			// TODO validate one value
-			return runtime.Seq(args[0])
+			if len(args) != 2 && len(args) != 3 {
+				return nil, errors.New("subs requires 2 or 3 args")
+			}
+			s, valid := args[0].(types.String)
+			if !valid {
+				return nil, errors.New("subs requires a string arg")
+			}
+			runes := []rune(string(s))
+			start, valid := args[1].(types.Integer)
+			if !valid {
+				return nil, errors.New("subs requires an integer start")
+			}
+			end := types.Integer(len(runes))
+			if len(args) == 3 {
+				end, valid = args[2].(types.Integer)
+				if !valid {
+					return nil, errors.New("subs requires an integer end")
+				}
+			}
+			if start < 0 || end < start || int(end) > len(runes) {
+				return nil, errors.New("subs index out of range")
+			}
+			return types.String(runes[start:end]), nil
 		},
 	})
-	env.Set("empty?", types.Function{
+	env.SetFn("split", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			// TODO validate one value
+			if len(args) != 2 {
+				return nil, errors.New("split requires 2 args")
+			}
+			s, valid := args[0].(types.String)
+			if !valid {
+				return nil, errors.New("split requires a string arg")
+			}
+			sep, valid := args[1].(types.String)
+			if !valid {
+				return nil, errors.New("split requires a string separator")
+			}
+			if s == "" {
+				return types.NewVector(), nil
+			}
+			parts := strings.Split(string(s), string(sep))
+			items := make([]types.MalType, len(parts))
+			for i, part := range parts {
+				items[i] = types.String(part)
+			}
+			return types.NewVector(items...), nil
+		},
+	})
+	env.SetFn("upper-case", stringFn("upper-case", strings.ToUpper))
+	env.SetFn("lower-case", stringFn("lower-case", strings.ToLower))
+	env.SetFn("trim", stringFn("trim", strings.TrimSpace))
+	env.SetFn("starts-with?", stringPredicate("starts-with?", strings.HasPrefix))
+	env.SetFn("ends-with?", stringPredicate("ends-with?", strings.HasSuffix))
+	env.SetFn("includes?", stringPredicate("includes?", strings.Contains))
+	env.SetFn("replace", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 3 {
+				return nil, errors.New("replace requires 3 args")
+			}
+			var strs [3]string
+			for i, arg := range args {
+				s, valid := arg.(types.String)
+				if !valid {
+					return nil, errors.New("replace requires string args")
+				}
+				strs[i] = string(s)
+			}
+			if strs[1] == "" {
+				return nil, errors.New("replace requires a non-empty match")
+			}
+			return types.String(strings.ReplaceAll(strs[0], strs[1], strs[2])), nil
+		},
+	})
+	env.SetFn("format", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) == 0 {
+				return nil, errors.New("format requires at least 1 arg")
+			}
+			f, valid := args[0].(types.String)
+			if !valid {
+				return nil, errors.New("format requires a string arg")
+			}
+			s, err := format(string(f), args[1:])
+			if err != nil {
+				return nil, err
+			}
+			return types.String(s), nil
+		},
+	})
+	env.SetFn("prn", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			err := printer.Fprintln(os.Stdout, PrintConfig(env, true), args...)
+			if err != nil {
+				return nil, err
+			}
+			return types.Nil{}, nil
+		},
+	})
+	env.SetFn("println", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			err := printer.Fprintln(os.Stdout, PrintConfig(env, false), args...)
+			if err != nil {
+				return nil, err
+			}
+			return types.Nil{}, nil
+		},
+	})
+	env.SetFn("read-string", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("read-string requires one arg")
+			}
+			s, valid := args[0].(types.String)
+			if !valid {
+				return nil, errors.New("read-string requires a string arg")
+			}
+			return reader.ReadStrWithOptions(string(s), ReaderOptions(env))
+		},
+	})
+	env.SetFn("parse-int", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			radix := 10
+			switch len(args) {
+			case 1:
+			case 2:
+				r, valid := args[1].(types.Integer)
+				if !valid {
+					return nil, errors.New("parse-int requires an integer radix")
+				}
+				radix = int(r)
+			default:
+				return nil, errors.New("parse-int requires 1 or 2 args")
+			}
+			s, valid := args[0].(types.String)
+			if !valid {
+				return nil, errors.New("parse-int requires a string arg")
+			}
+			i, err := strconv.ParseInt(string(s), radix, 64)
+			if err != nil {
+				return nil, errors.New("parse-int could not parse " + strconv.Quote(string(s)))
+			}
+			return types.Integer(i), nil
+		},
+	})
+	env.SetFn("slurp", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("slurp requires 1 arg")
+			}
+			s, valid := args[0].(types.String)
+			if !valid {
+				return nil, errors.New("slurp requires a string arg")
+			}
+			bytes, err := slurp(string(s))
+			if err != nil {
+				return nil, err
+			}
+			return types.String(string(bytes)), nil
+		},
+	})
+	env.SetFn("spit", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("spit requires 2 args")
+			}
+			s, valid := args[0].(types.String)
+			if !valid {
+				return nil, errors.New("spit requires a string path")
+			}
+			content := printer.PrintStr(printer.Config{Readably: false}, args[1])
+			if err := ioutil.WriteFile(string(s), []byte(content), 0644); err != nil {
+				return nil, err
+			}
+			return types.Nil{}, nil
+		},
+	})
+	env.SetFn("atom", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("atom requires 1 arg")
+			}
+			return &types.Atom{Value: args[0]}, nil
+		},
+	})
+	env.SetFn("atom?", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("atom? requires 1 arg")
+			}
+			_, valid := args[0].(*types.Atom)
+			return types.Boolean(valid), nil
+		},
+	})
+	env.SetFn("deref", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 && len(args) != 3 {
+				return nil, errors.New("deref requires 1 or 3 args")
+			}
+			ref, valid := args[0].(types.Derefable)
+			if !valid {
+				return nil, errors.New("deref requires a derefable value")
+			}
+			pending, valid := ref.(types.Awaitable)
+			if !valid {
+				return ref.Deref()
+			}
+			var timeout <-chan time.Time
+			if len(args) == 3 {
+				ms, valid := args[1].(types.Integer)
+				if !valid {
+					return nil, errors.New("deref requires an integer timeout in milliseconds")
+				}
+				timer := time.NewTimer(time.Duration(ms) * time.Millisecond)
+				defer timer.Stop()
+				timeout = timer.C
+			}
+			ctx := context.Background()
+			if options.Context != nil {
+				ctx = options.Context()
+			}
+			select {
+			case <-pending.Done():
+				return pending.Deref()
+			case <-timeout:
+				return args[2], nil
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		},
+	})
+	env.SetFn("promise", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 0 {
+				return nil, errors.New("promise requires 0 args")
+			}
+			return types.NewPromise(), nil
+		},
+	})
+	env.SetFn("delay*", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("delay* requires 1 arg")
+			}
+			fn, err := fnArg("delay*", args[0])
+			if err != nil {
+				return nil, err
+			}
+			return types.NewDelay(func() (types.MalType, error) { return fn.Fn() }), nil
+		},
+	})
+	env.SetFn("future*", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("future* requires 1 arg")
+			}
+			fn, err := fnArg("future*", args[0])
+			if err != nil {
+				return nil, err
+			}
+			return types.NewFuture(func() (types.MalType, error) { return fn.Fn() }), nil
+		},
+	})
+	env.SetFn("future?", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("future? requires 1 arg")
+			}
+			_, valid := args[0].(*types.Future)
+			return types.Boolean(valid), nil
+		},
+	})
+	env.SetFn("volatile!", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("volatile! requires 1 arg")
+			}
+			return &types.Volatile{Value: args[0]}, nil
+		},
+	})
+	env.SetFn("volatile?", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("volatile? requires 1 arg")
+			}
+			_, valid := args[0].(*types.Volatile)
+			return types.Boolean(valid), nil
+		},
+	})
+	env.SetFn("vreset!", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("vreset! requires 2 args")
+			}
+			v, valid := args[0].(*types.Volatile)
+			if !valid {
+				return nil, errors.New("vreset! requires a volatile")
+			}
+			v.Value = args[1]
+			return v.Value, nil
+		},
+	})
+	env.SetFn("vswap!", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) < 2 {
+				return nil, errors.New("vswap! requires at least 2 args")
+			}
+			v, valid := args[0].(*types.Volatile)
+			if !valid {
+				return nil, errors.New("vswap! requires a volatile")
+			}
+			fn, err := fnArg("vswap!", args[1])
+			if err != nil {
+				return nil, err
+			}
+			value, err := fn.Fn(append([]types.MalType{v.Value}, args[2:]...)...)
+			if err != nil {
+				return nil, err
+			}
+			v.Value = value
+			return value, nil
+		},
+	})
+	env.SetFn("force", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("force requires 1 arg")
+			}
+			if d, valid := args[0].(*types.Delay); valid {
+				return d.Deref()
+			}
+			return args[0], nil
+		},
+	})
+	env.SetFn("realized?", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("realized? requires 1 arg")
+			}
+			r, valid := args[0].(types.Realizable)
+			if !valid {
+				return nil, errors.New("realized? requires a delay, promise, or future")
+			}
+			return types.Boolean(r.Realized()), nil
+		},
+	})
+	env.SetFn("deliver", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("deliver requires 2 args")
+			}
+			p, valid := args[0].(*types.Promise)
+			if !valid {
+				return nil, errors.New("deliver requires a promise value")
+			}
+			if !p.Deliver(args[1]) {
+				return types.Nil{}, nil
+			}
+			return p, nil
+		},
+	})
+	env.SetFn("reset!", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("reset! requires 2 args")
+			}
+			atom, valid := args[0].(*types.Atom)
+			if !valid {
+				return nil, errors.New("reset! requires an atom value")
+			}
+			value := args[1]
+			atom.Set(value)
+			return value, nil
+		},
+	})
+	env.SetFn("swap!", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			_, value, err := swap("swap!", args)
+			if err != nil {
+				return nil, err
+			}
+			return value, nil
+		},
+	})
+	env.SetFn("swap-vals!", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			old, value, err := swap("swap-vals!", args)
+			if err != nil {
+				return nil, err
+			}
+			return types.NewVector(old, value), nil
+		},
+	})
+	env.SetFn("seq", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			// TODO validate one value
+			return runtime.Seq(args[0])
+		},
+	})
+	env.SetFn("empty?", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			// TODO validate one value
 			return runtime.Empty(args[0])
 		},
 	})
-	env.Set("first", types.Function{
+	env.SetFn("first", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			seq, err := runtime.Seq(args[0])
 			if err != nil {
@@ -380,7 +1243,7 @@ func BuildEnv() *types.Env {
 			return head, nil
 		},
 	})
-	env.Set("rest", types.Function{
+	env.SetFn("rest", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			seq, err := runtime.Seq(args[0])
 			if err != nil {
@@ -393,7 +1256,7 @@ func BuildEnv() *types.Env {
 			return tail, nil
 		},
 	})
-	env.Set("take", types.Function{
+	env.SetFn("take", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			seq, _, err := runtime.TakeDrop(args[0], args[1])
 			if err != nil {
@@ -402,7 +1265,148 @@ func BuildEnv() *types.Env {
 			return seq, nil
 		},
 	})
-	env.Set("cons", types.Function{
+	env.SetFn("drop", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("drop requires 2 args")
+			}
+			n, valid := args[0].(types.Integer)
+			if !valid {
+				return nil, errors.New("drop requires an integer count")
+			}
+			if n < 0 {
+				return nil, errors.New("drop requires a non-negative count")
+			}
+			_, seq, err := runtime.TakeDrop(n, args[1])
+			if err != nil {
+				return nil, err
+			}
+			if empty, _, _ := seq.Next(); empty {
+				return types.NewList(), nil
+			}
+			return seq, nil
+		},
+	})
+	env.SetFn("every?", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("every? requires 2 args")
+			}
+			pred, err := fnArg("every?", args[0])
+			if err != nil {
+				return nil, err
+			}
+			seq, err := runtime.Seq(args[1])
+			if err != nil {
+				return nil, err
+			}
+			for {
+				empty, head, tail := seq.Next()
+				if empty {
+					return types.Boolean(true), nil
+				}
+				result, err := pred.Fn(head)
+				if err != nil {
+					return nil, err
+				}
+				if !runtime.Truthy(result) {
+					return types.Boolean(false), nil
+				}
+				seq = tail
+			}
+		},
+	})
+	env.SetFn("some", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("some requires 2 args")
+			}
+			pred, err := fnArg("some", args[0])
+			if err != nil {
+				return nil, err
+			}
+			seq, err := runtime.Seq(args[1])
+			if err != nil {
+				return nil, err
+			}
+			for {
+				empty, head, tail := seq.Next()
+				if empty {
+					return types.Nil{}, nil
+				}
+				result, err := pred.Fn(head)
+				if err != nil {
+					return nil, err
+				}
+				if runtime.Truthy(result) {
+					return result, nil
+				}
+				seq = tail
+			}
+		},
+	})
+	env.SetFn("take-while", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("take-while requires 2 args")
+			}
+			pred, err := fnArg("take-while", args[0])
+			if err != nil {
+				return nil, err
+			}
+			seq, err := runtime.Seq(args[1])
+			if err != nil {
+				return nil, err
+			}
+			var items []types.MalType
+			for {
+				empty, head, tail := seq.Next()
+				if empty {
+					break
+				}
+				result, err := pred.Fn(head)
+				if err != nil {
+					return nil, err
+				}
+				if !runtime.Truthy(result) {
+					break
+				}
+				items = append(items, head)
+				seq = tail
+			}
+			return types.NewList(items...), nil
+		},
+	})
+	env.SetFn("drop-while", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("drop-while requires 2 args")
+			}
+			pred, err := fnArg("drop-while", args[0])
+			if err != nil {
+				return nil, err
+			}
+			seq, err := runtime.Seq(args[1])
+			if err != nil {
+				return nil, err
+			}
+			for {
+				empty, head, tail := seq.Next()
+				if empty {
+					return types.NewList(), nil
+				}
+				result, err := pred.Fn(head)
+				if err != nil {
+					return nil, err
+				}
+				if !runtime.Truthy(result) {
+					return seq, nil
+				}
+				seq = tail
+			}
+		},
+	})
+	env.SetFn("cons", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			seq, err := runtime.Seq(args[1])
 			if err != nil {
@@ -411,7 +1415,7 @@ func BuildEnv() *types.Env {
 			return types.ConsCell{Head: args[0], Tail: seq}, nil
 		},
 	})
-	env.Set("concat", types.Function{
+	env.SetFn("concat", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			seq, err := runtime.Concat(args...)
 			if err != nil {
@@ -420,7 +1424,66 @@ func BuildEnv() *types.Env {
 			return seq, nil
 		},
 	})
-	env.Set("conj", types.Function{
+	env.SetFn("queue", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			return types.NewQueue(args...), nil
+		},
+	})
+	env.SetFn("peek", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("peek requires 1 arg")
+			}
+			var value types.MalType
+			var found bool
+			switch coll := args[0].(type) {
+			case types.Queue:
+				value, found = coll.Peek()
+			case types.List:
+				if coll.Imm.Len() > 0 {
+					value, found = coll.Imm.Get(0), true
+				}
+			case types.Vector:
+				if n := coll.Imm.Len(); n > 0 {
+					value, found = coll.Imm.Get(n-1), true
+				}
+			case types.Nil:
+			default:
+				return nil, errors.New("peek requires a queue, list, or vector")
+			}
+			if !found {
+				return types.Nil{}, nil
+			}
+			return value, nil
+		},
+	})
+	env.SetFn("pop", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("pop requires 1 arg")
+			}
+			switch coll := args[0].(type) {
+			case types.Queue:
+				if popped, ok := coll.Pop(); ok {
+					return popped, nil
+				}
+			case types.List:
+				if n := coll.Imm.Len(); n > 0 {
+					return types.List{Imm: coll.Imm.Slice(1, n)}, nil
+				}
+			case types.Vector:
+				if n := coll.Imm.Len(); n > 0 {
+					return types.Vector{Imm: coll.Imm.Slice(0, n-1)}, nil
+				}
+			case types.Nil:
+				return types.Nil{}, nil
+			default:
+				return nil, errors.New("pop requires a queue, list, or vector")
+			}
+			return nil, errors.New("pop requires a non-empty collection")
+		},
+	})
+	env.SetFn("conj", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			conjed, err := runtime.Conj(args[0], args[1:]...)
 			if err != nil {
@@ -429,47 +1492,225 @@ func BuildEnv() *types.Env {
 			return conjed, nil
 		},
 	})
-	env.Set("into", types.Function{
+	env.SetFn("into", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			conjed, err := runtime.Into(args[0], args[1])
+			conjed, err := runtime.IntoWithProgress(args[0], args[1], options.Progress)
 			if err != nil {
 				return nil, err
 			}
 			return conjed, nil
 		},
 	})
-	env.Set("nth", types.Function{
+	env.SetFn("nth", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			return runtime.Nth(args[0], args[1])
 		},
 	})
-	env.Set("throw", types.Function{
+	env.SetFn("last", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("last requires 1 arg")
+			}
+			return runtime.Last(args[0])
+		},
+	})
+	env.SetFn("butlast", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("butlast requires 1 arg")
+			}
+			items, err := runtime.IntoSlice(args[0])
+			if err != nil {
+				return nil, err
+			}
+			if len(items) == 0 {
+				return types.NewList(), nil
+			}
+			return types.NewList(items[:len(items)-1]...), nil
+		},
+	})
+	env.SetFn("drop-last", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
+			var n int64 = 1
+			switch len(args) {
+			case 1:
+			case 2:
+				i, valid := args[0].(types.Integer)
+				if !valid {
+					return nil, errors.New("drop-last requires an integer count")
+				}
+				if i < 0 {
+					return nil, errors.New("drop-last requires a non-negative count")
+				}
+				n = int64(i)
+			default:
+				return nil, errors.New("drop-last requires 1 or 2 args")
+			}
+			items, err := runtime.IntoSlice(args[len(args)-1])
+			if err != nil {
+				return nil, err
+			}
+			if n >= int64(len(items)) {
+				return types.NewList(), nil
+			}
+			return types.NewList(items[:int64(len(items))-n]...), nil
+		},
+	})
+	env.SetFn("throw", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("throw requires 1 arg")
+			}
+			// Errors are thrown as themselves, so caught errors may be rethrown
+			if err, valid := args[0].(error); valid {
+				return nil, err
+			}
 			return nil, types.MalError{Reason: args[0]}
 		},
 	})
-	env.Set("symbol?", types.Function{
+	env.SetFn("ex-info", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("ex-info requires 2 args")
+			}
+			message, valid := args[0].(types.String)
+			if !valid {
+				return nil, errors.New("ex-info requires a string message")
+			}
+			data, valid := args[1].(types.Map)
+			if !valid {
+				return nil, errors.New("ex-info requires a data map")
+			}
+			return types.ExInfo{Message: string(message), Data: data}, nil
+		},
+	})
+	env.SetFn("ex-data", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("ex-data requires 1 arg")
+			}
+			if e, valid := args[0].(types.ExInfo); valid {
+				return e.Data, nil
+			}
+			return types.Nil{}, nil
+		},
+	})
+	env.SetFn("ex-message", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("ex-message requires 1 arg")
+			}
+			if e, valid := args[0].(error); valid {
+				return types.String(e.Error()), nil
+			}
+			return types.Nil{}, nil
+		},
+	})
+	env.SetFn("symbol?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			_, valid := args[0].(types.Symbol)
 			return types.Boolean(valid), nil
 		},
 	})
-	env.Set("symbol", types.Function{
+	env.SetFn("symbol", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			name, valid := args[0].(types.String)
+			if !valid {
+				return nil, errors.New("Invalid arg")
+			}
+			return types.NewSymbol(string(name)), nil
+		},
+	})
+	env.SetFn("gensym", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			prefix := "G__"
+			switch len(args) {
+			case 0:
+			case 1:
+				s, valid := args[0].(types.String)
+				if !valid {
+					return nil, errors.New("gensym requires a string prefix")
+				}
+				prefix = string(s)
+			default:
+				return nil, errors.New("gensym requires 0 or 1 args")
+			}
+			return Gensym(prefix), nil
+		},
+	})
+	env.SetFn("name", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("name requires 1 arg")
+			}
+			switch v := args[0].(type) {
+			case types.Keyword:
+				return types.String(v.LocalName()), nil
+			case types.Symbol:
+				return types.String(v.LocalName()), nil
+			case types.String:
+				return v, nil
+			default:
+				return nil, errors.New("name requires a keyword, symbol, or string")
+			}
+		},
+	})
+	env.SetFn("namespace", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("namespace requires 1 arg")
+			}
+			var ns string
+			switch v := args[0].(type) {
+			case types.Keyword:
+				ns = v.Namespace
+			case types.Symbol:
+				ns = v.Namespace
+			default:
+				return nil, errors.New("namespace requires a keyword or symbol")
+			}
+			if ns == "" {
+				return types.Nil{}, nil
+			}
+			return types.String(ns), nil
+		},
+	})
+	env.SetFn("identical?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			name, valid := args[0].(types.String)
-			if !valid {
-				return nil, errors.New("Invalid arg")
+			if len(args) != 2 {
+				return nil, errors.New("identical? requires 2 args")
+			}
+			switch this := args[0].(type) {
+			case types.Keyword:
+				that, valid := args[1].(types.Keyword)
+				return types.Boolean(valid && this.Identical(that)), nil
+			case types.Symbol:
+				that, valid := args[1].(types.Symbol)
+				return types.Boolean(valid && this.Identical(that)), nil
+			case types.Map:
+				that, valid := args[1].(types.Map)
+				return types.Boolean(valid && this.Imm == that.Imm), nil
+			case types.List:
+				that, valid := args[1].(types.List)
+				return types.Boolean(valid && this.Imm == that.Imm), nil
+			case types.Vector:
+				that, valid := args[1].(types.Vector)
+				return types.Boolean(valid && this.Imm == that.Imm), nil
+			case types.Function, *types.Atom, *types.Promise, *types.Future, *types.Volatile, *types.StringBuilder:
+				// References are equal only to themselves
+				return types.Boolean(types.Equals(this, args[1])), nil
+			default:
+				return types.Boolean(false), nil
 			}
-			return types.NewSymbol(string(name)), nil
 		},
 	})
-	env.Set("keyword?", types.Function{
+	env.SetFn("keyword?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			_, valid := args[0].(types.Keyword)
 			return types.Boolean(valid), nil
 		},
 	})
-	env.Set("keyword", types.Function{
+	env.SetFn("keyword", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			var name string
 			switch v := args[0].(type) {
@@ -485,13 +1726,29 @@ func BuildEnv() *types.Env {
 			return types.NewKeyword(name), nil
 		},
 	})
-	env.Set("nil?", types.Function{
+	env.SetFn("intern-keyword", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("intern-keyword requires 1 arg")
+			}
+			name, valid := args[0].(types.String)
+			if !valid {
+				return nil, errors.New("intern-keyword requires a string arg")
+			}
+			keyword := types.NewKeyword(string(name))
+			if !keyword.Interned() {
+				return nil, errors.New("intern-keyword can't intern more names")
+			}
+			return keyword, nil
+		},
+	})
+	env.SetFn("nil?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			_, valid := args[0].(types.Nil)
 			return types.Boolean(valid), nil
 		},
 	})
-	env.Set("true?", types.Function{
+	env.SetFn("true?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			b, valid := args[0].(types.Boolean)
 			if !valid {
@@ -500,7 +1757,7 @@ func BuildEnv() *types.Env {
 			return b, nil
 		},
 	})
-	env.Set("false?", types.Function{
+	env.SetFn("false?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			b, valid := args[0].(types.Boolean)
 			if !valid {
@@ -509,35 +1766,39 @@ func BuildEnv() *types.Env {
 			return types.Boolean(!bool(b)), nil
 		},
 	})
-	env.Set("sequential?", types.Function{
+	env.SetFn("sequential?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			_, valid := args[0].(types.Sequential)
 			return types.Boolean(valid), nil
 		},
 	})
-	env.Set("vector?", types.Function{
+	env.SetFn("vector?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			_, valid := args[0].(types.Vector)
 			return types.Boolean(valid), nil
 		},
 	})
-	env.Set("map?", types.Function{
+	env.SetFn("map?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			_, valid := args[0].(types.Map)
 			return types.Boolean(valid), nil
 		},
 	})
 	// TODO lazy seq
-	env.Set("map", types.Function{
+	env.SetFn("map", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			fn, valid := args[0].(types.Function)
-			if !valid {
-				return nil, errors.New("Invalid")
+			fn, err := fnArg("map", args[0])
+			if err != nil {
+				return nil, err
 			}
 			seq, err := runtime.Seq(args[1])
 			if err != nil {
 				return nil, err
 			}
+			// map is eager, so it could never finish an unbounded seq
+			if types.Unbounded(seq) {
+				return nil, errors.New("map requires a finite seq")
+			}
 			var items []types.MalType
 			for {
 				empty, head, tail := seq.Next()
@@ -550,18 +1811,86 @@ func BuildEnv() *types.Env {
 				}
 				items = append(items, item)
 				seq = tail
+				runtime.Progress(options.Progress, len(items))
+			}
+		},
+	})
+	env.SetFn("mapcat", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("mapcat requires 2 args")
+			}
+			fn, err := fnArg("mapcat", args[0])
+			if err != nil {
+				return nil, err
+			}
+			seq, err := runtime.Seq(args[1])
+			if err != nil {
+				return nil, err
+			}
+			var results []types.MalType
+			for {
+				empty, head, tail := seq.Next()
+				if empty {
+					return runtime.Concat(results...)
+				}
+				result, err := fn.Fn(head)
+				if err != nil {
+					return nil, err
+				}
+				results = append(results, result)
+				seq = tail
+				runtime.Progress(options.Progress, len(results))
+			}
+		},
+	})
+	env.SetFn("reduce", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 && len(args) != 3 {
+				return nil, errors.New("reduce requires 2 or 3 args")
+			}
+			fn, err := fnArg("reduce", args[0])
+			if err != nil {
+				return nil, err
+			}
+			seq, err := runtime.Seq(args[len(args)-1])
+			if err != nil {
+				return nil, err
+			}
+			var acc types.MalType
+			if len(args) == 3 {
+				acc = args[1]
+			} else {
+				empty, head, tail := seq.Next()
+				if empty {
+					return fn.Fn()
+				}
+				acc = head
+				seq = tail
+			}
+			for count := 1; ; count++ {
+				empty, head, tail := seq.Next()
+				if empty {
+					return acc, nil
+				}
+				acc, err = fn.Fn(acc, head)
+				if err != nil {
+					return nil, err
+				}
+				seq = tail
+				runtime.Progress(options.Progress, count)
 			}
 		},
 	})
-	env.Set("apply", types.Function{
+	env.SetFn("apply", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			total := len(args)
 			if total < 2 {
 				return nil, errors.New("invalid")
 			}
-			fn, valid := args[0].(types.Function)
-			if !valid {
-				return nil, errors.New("Invalid")
+			fn, err := fnArg("apply", args[0])
+			if err != nil {
+				return nil, err
 			}
 			fnargs := args[1:(total - 1)]
 			seq, err := runtime.Seq(args[total-1])
@@ -582,49 +1911,132 @@ func BuildEnv() *types.Env {
 			return fn.Fn(fnargs...)
 		},
 	})
-	env.Set("vector", types.Function{
+	env.SetFn("sort", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			var comparator *types.Function
+			switch len(args) {
+			case 1:
+			case 2:
+				fn, err := fnArg("sort", args[0])
+				if err != nil {
+					return nil, err
+				}
+				comparator = &fn
+			default:
+				return nil, errors.New("sort requires 1 or 2 args")
+			}
+			items, err := runtime.IntoSliceWithProgress(args[len(args)-1], options.Progress)
+			if err != nil {
+				return nil, err
+			}
+			return sortStable(items, items, comparator)
+		},
+	})
+	env.SetFn("sort-by", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			var comparator *types.Function
+			switch len(args) {
+			case 2:
+			case 3:
+				fn, err := fnArg("sort-by", args[1])
+				if err != nil {
+					return nil, err
+				}
+				comparator = &fn
+			default:
+				return nil, errors.New("sort-by requires 2 or 3 args")
+			}
+			keyfn, err := fnArg("sort-by", args[0])
+			if err != nil {
+				return nil, err
+			}
+			items, err := runtime.IntoSliceWithProgress(args[len(args)-1], options.Progress)
+			if err != nil {
+				return nil, err
+			}
+			keys := make([]types.MalType, len(items))
+			for i, item := range items {
+				key, err := keyfn.Fn(item)
+				if err != nil {
+					return nil, err
+				}
+				keys[i] = key
+			}
+			return sortStable(items, keys, comparator)
+		},
+	})
+	env.SetFn("vector", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			return types.NewVector(args), nil
 		},
 	})
-	env.Set("hash-map", types.Function{
+	env.SetFn("hash-map", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			if len(args)%2 != 0 {
-				return nil, errors.New("invalid")
+				return nil, fmt.Errorf("hash-map requires an even number of args, got %d", len(args))
 			}
 			return types.NewMap(args...), nil
 		},
 	})
-	env.Set("assoc", types.Function{
+	env.SetFn("frequencies", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("frequencies requires 1 arg")
+			}
+			seq, err := runtime.Seq(args[0])
+			if err != nil {
+				return nil, err
+			}
+			m := types.NewMap()
+			for {
+				empty, head, tail := seq.Next()
+				if empty {
+					break
+				}
+				count, found := m.Lookup(head)
+				if !found {
+					count = types.Integer(0)
+				}
+				m = m.Assoc(head, count.(types.Integer)+1)
+				seq = tail
+			}
+			return m, nil
+		},
+	})
+	env.SetFn("assoc", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) == 0 {
+				return nil, errors.New("assoc requires at least 1 arg")
+			}
 			m, valid := args[0].(types.Map)
 			if !valid {
-				return nil, errors.New("invalid")
+				if _, isNil := args[0].(types.Nil); !isNil {
+					return nil, errors.New("assoc requires a map or nil")
+				}
+				m = types.NewMap()
 			}
 			if len(args)%2 != 1 {
-				return nil, errors.New("invalid")
+				return nil, fmt.Errorf("assoc requires an even number of key and value args, got %d", len(args)-1)
 			}
-			b := immutable.NewMapBuilder(m.Imm)
 			for i := 1; i < len(args); i += 2 {
-				b.Set(args[1], args[i+1])
+				m = m.Assoc(args[i], args[i+1])
 			}
-			return types.Map{Imm: b.Map()}, nil
+			return m, nil
 		},
 	})
-	env.Set("dissoc", types.Function{
+	env.SetFn("dissoc", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			m, valid := args[0].(types.Map)
 			if !valid {
 				return nil, errors.New("invalid")
 			}
-			b := immutable.NewMapBuilder(m.Imm)
 			for _, k := range args[1:] {
-				b.Delete(k)
+				m = m.Dissoc(k)
 			}
-			return types.Map{Imm: b.Map()}, nil
+			return m, nil
 		},
 	})
-	env.Set("get", types.Function{
+	env.SetFn("get", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			var notfound types.MalType
 			if len(args) == 2 {
@@ -635,66 +2047,324 @@ func BuildEnv() *types.Env {
 			return runtime.Get(args[0], args[1], notfound), nil
 		},
 	})
-	env.Set("contains?", types.Function{
+	env.SetFn("get-in", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			var notfound types.MalType
+			switch len(args) {
+			case 2:
+				notfound = types.Nil{}
+			case 3:
+				notfound = args[2]
+			default:
+				return nil, errors.New("get-in requires 2 or 3 args")
+			}
+			return runtime.GetIn(args[0], args[1], notfound)
+		},
+	})
+	env.SetFn("assoc-in", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 3 {
+				return nil, errors.New("assoc-in requires 3 args")
+			}
+			return runtime.AssocIn(args[0], args[1], args[2])
+		},
+	})
+	env.SetFn("update", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) < 3 {
+				return nil, errors.New("update requires at least 3 args")
+			}
+			return update("update", args[0], types.NewVector(args[1]), args[2], args[3:])
+		},
+	})
+	env.SetFn("update-in", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) < 3 {
+				return nil, errors.New("update-in requires at least 3 args")
+			}
+			return update("update-in", args[0], args[1], args[2], args[3:])
+		},
+	})
+	env.SetFn("zipmap", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("zipmap requires 2 args")
+			}
+			keys, err := runtime.Seq(args[0])
+			if err != nil {
+				return nil, err
+			}
+			vals, err := runtime.Seq(args[1])
+			if err != nil {
+				return nil, err
+			}
+			m := types.NewMap()
+			for {
+				keysEmpty, k, keysTail := keys.Next()
+				valsEmpty, v, valsTail := vals.Next()
+				if keysEmpty || valsEmpty {
+					return m, nil
+				}
+				m = m.Assoc(k, v)
+				keys = keysTail
+				vals = valsTail
+			}
+		},
+	})
+	env.SetFn("select-keys", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("select-keys requires 2 args")
+			}
+			switch args[0].(type) {
+			case types.Map, types.Nil:
+			default:
+				return nil, errors.New("select-keys requires a map")
+			}
+			keys, err := runtime.IntoSlice(args[1])
+			if err != nil {
+				return nil, err
+			}
+			indexed := args[0].(types.Indexed)
+			m := types.NewMap()
+			for _, k := range keys {
+				if v, found := indexed.Lookup(k); found {
+					m = m.Assoc(k, v)
+				}
+			}
+			return m, nil
+		},
+	})
+	env.SetFn("contains?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			return runtime.Contains(args[0], args[1]), nil
 		},
 	})
-	env.Set("keys", types.Function{
+	env.SetFn("keys", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			return runtime.Keys(args[0])
 		},
 	})
-	env.Set("vals", types.Function{
+	env.SetFn("vals", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			return runtime.Vals(args[0])
 		},
 	})
-	env.Set("hash", types.Function{
+	env.SetFn("hash", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			return types.Integer(types.Hash(args[0])), nil
 		},
 	})
-	env.Set("with-meta", types.Function{
+	env.SetFn("with-meta", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("with-meta requires 2 args")
+			}
+			// Atoms are references, so a copy with other metadata would not
+			// be the same atom
+			if _, valid := args[0].(*types.Atom); valid {
+				return nil, errors.New("with-meta can't copy an atom; use reset-meta! or alter-meta! to change its metadata")
+			}
 			return runtime.WithMeta(args[0], args[1])
 		},
 	})
-	env.Set("meta", types.Function{
+	env.SetFn("meta", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			return runtime.Meta(args[0])
 		},
 	})
-	env.Set("time-ms", types.Function{
+	env.SetFn("vary-meta", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) < 2 {
+				return nil, errors.New("vary-meta requires at least 2 args")
+			}
+			if _, valid := args[0].(*types.Atom); valid {
+				return nil, errors.New("vary-meta can't copy an atom; use alter-meta! to change its metadata")
+			}
+			fn, err := fnArg("vary-meta", args[1])
+			if err != nil {
+				return nil, err
+			}
+			md, err := runtime.Meta(args[0])
+			if err != nil {
+				return nil, err
+			}
+			md, err = fn.Fn(append([]types.MalType{md}, args[2:]...)...)
+			if err != nil {
+				return nil, err
+			}
+			return runtime.WithMeta(args[0], md)
+		},
+	})
+	env.SetFn("reset-meta!", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("reset-meta! requires 2 args")
+			}
+			atom, valid := args[0].(*types.Atom)
+			if !valid {
+				return nil, errors.New("reset-meta! requires an atom value")
+			}
+			md, err := metaMap("reset-meta!", args[1])
+			if err != nil {
+				return nil, err
+			}
+			atom.ResetMeta(md)
+			return args[1], nil
+		},
+	})
+	env.SetFn("alter-meta!", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) < 2 {
+				return nil, errors.New("alter-meta! requires at least 2 args")
+			}
+			atom, valid := args[0].(*types.Atom)
+			if !valid {
+				return nil, errors.New("alter-meta! requires an atom value")
+			}
+			fn, err := fnArg("alter-meta!", args[1])
+			if err != nil {
+				return nil, err
+			}
+			md, err := atom.AlterMeta(func(md types.Map) (types.Map, error) {
+				var current types.MalType = md
+				if md.Imm == nil {
+					current = types.Nil{}
+				}
+				value, err := fn.Fn(append([]types.MalType{current}, args[2:]...)...)
+				if err != nil {
+					return types.Map{}, err
+				}
+				return metaMap("alter-meta!", value)
+			})
+			if err != nil {
+				return nil, err
+			}
+			if md.Imm == nil {
+				return types.Nil{}, nil
+			}
+			return md, nil
+		},
+	})
+	env.SetFn("time-ms", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			return types.Integer(time.Now().UnixNano() / int64(time.Millisecond)), nil
+		},
+	})
+	env.SetFn("nano-time", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 0 {
+				return nil, errors.New("nano-time requires 0 args")
+			}
+			// Read from the monotonic clock so successive times never decrease
+			return types.Integer(time.Since(epoch).Nanoseconds()), nil
+		},
+	})
+	env.SetFn("bench*", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 2 {
+				return nil, errors.New("bench* requires 2 args")
+			}
+			fn, err := fnArg("bench*", args[0])
+			if err != nil {
+				return nil, err
+			}
+			n, valid := args[1].(types.Integer)
+			if !valid || n < 1 {
+				return nil, errors.New("bench* requires a positive integer count")
+			}
+			var min, max, total time.Duration
+			for i := types.Integer(0); i < n; i++ {
+				start := time.Now()
+				if _, err := fn.Fn(); err != nil {
+					return nil, err
+				}
+				elapsed := time.Since(start)
+				if i == 0 || elapsed < min {
+					min = elapsed
+				}
+				if elapsed > max {
+					max = elapsed
+				}
+				total += elapsed
+			}
+			return types.NewMap(
+				types.NewKeyword("min"), types.Integer(min.Milliseconds()),
+				types.NewKeyword("max"), types.Integer(max.Milliseconds()),
+				types.NewKeyword("mean"), types.Integer((total / time.Duration(n)).Milliseconds()),
+				types.NewKeyword("total"), types.Integer(total.Milliseconds()),
+			), nil
+		},
+	})
+	env.SetFn("gc", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			return types.Integer(time.Now().Unix()), nil
+			if len(args) != 0 {
+				return nil, errors.New("gc requires 0 args")
+			}
+			goruntime.GC()
+			return types.Nil{}, nil
 		},
 	})
-	env.Set("string?", types.Function{
+	env.SetFn("string?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			_, valid := args[0].(types.String)
 			return types.Boolean(valid), nil
 		},
 	})
-	env.Set("number?", types.Function{
+	env.SetFn("char?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
-			_, valid := args[0].(types.Integer)
+			if len(args) != 1 {
+				return nil, errors.New("char? requires 1 arg")
+			}
+			_, valid := args[0].(types.Rune)
 			return types.Boolean(valid), nil
 		},
 	})
-	env.Set("fn?", types.Function{
+	env.SetFn("type", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 1 {
+				return nil, errors.New("type requires 1 arg")
+			}
+			return runtime.Type(args[0]), nil
+		},
+	})
+	env.SetFn("number?", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			switch args[0].(type) {
+			case types.Integer, types.BigInt:
+				return types.Boolean(true), nil
+			default:
+				return types.Boolean(false), nil
+			}
+		},
+	})
+	env.SetFn("fn?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			fn, valid := args[0].(types.Function)
 			return types.Boolean(valid && !fn.IsMacro), nil
 		},
 	})
-	env.Set("macro?", types.Function{
+	env.SetFn("macro?", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			fn, valid := args[0].(types.Function)
 			return types.Boolean(valid && fn.IsMacro), nil
 		},
 	})
-	env.Set("range", types.Function{
+	env.SetFn("counter", types.Function{
+		Fn: func(args ...types.MalType) (types.MalType, error) {
+			if len(args) != 0 {
+				return nil, errors.New("counter requires 0 args")
+			}
+			var n int64
+			return types.Function{
+				Fn: func(args ...types.MalType) (types.MalType, error) {
+					return types.Integer(atomic.AddInt64(&n, 1)), nil
+				},
+				ID: types.NewFnID(),
+			}, nil
+		},
+	})
+	env.SetFn("range", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			return runtime.Range(args...)
 		},
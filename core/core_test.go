@@ -0,0 +1,639 @@
+package core
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/dball/glimpse/printer"
+	"github.com/dball/glimpse/reader"
+	"github.com/dball/glimpse/types"
+)
+
+// call applies the named builtin to args read from a string
+func call(env *types.Env, name string, args string) (types.MalType, error) {
+	value, err := env.Get(name)
+	if err != nil {
+		return nil, err
+	}
+	form, err := reader.ReadStrWithOptions("["+args+"]", reader.Options{PromoteIntegers: true})
+	if err != nil {
+		return nil, err
+	}
+	items := form.(types.Vector)
+	var values []types.MalType
+	itr := items.Imm.Iterator()
+	for !itr.Done() {
+		_, item := itr.Next()
+		values = append(values, item)
+	}
+	return value.(types.Function).Fn(values...)
+}
+
+type callTest struct {
+	name     string
+	args     string
+	expected string
+}
+
+// callTests calls each builtin and compares the printed result, or the
+// error message if expected is prefixed with error:
+func callTests(t *testing.T, env *types.Env, tests []callTest) {
+	t.Helper()
+	for _, test := range tests {
+		value, err := call(env, test.name, test.args)
+		var actual string
+		if err != nil {
+			actual = "error: " + err.Error()
+		} else {
+			actual = printer.PrintStr(printer.Config{Readably: true}, value)
+		}
+		if actual != test.expected {
+			t.Errorf("(%s %s): expected %s, got %s", test.name, test.args, test.expected, actual)
+		}
+	}
+}
+
+func TestArithmeticShortcuts(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"inc", "1", "2"},
+		{"inc", "-1", "0"},
+		{"dec", "0", "-1"},
+		{"abs", "-3", "3"},
+		{"abs", "3", "3"},
+		{"abs", "0", "0"},
+		{"abs", "-9223372036854775807", "9223372036854775807"},
+		{"abs", "-9223372036854775808", "9223372036854775808"},
+		{"abs", `"a"`, "error: abs requires an integer arg"},
+		{"abs", "1 2", "error: abs requires 1 arg"},
+	})
+}
+
+func TestBigIntArithmetic(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"+", "", "0"},
+		{"+", "1 2 3", "6"},
+		{"+", "9223372036854775807 1", "9223372036854775808"},
+		{"+", "9223372036854775808 -1", "9223372036854775807"},
+		{"type", "9223372036854775808", ":bigint"},
+		{"-", "1", "-1"},
+		{"-", "-9223372036854775808", "9223372036854775808"},
+		{"-", "-9223372036854775808 1", "-9223372036854775809"},
+		{"-", "10 1 2", "7"},
+		{"-", "", "error: - requires at least one arg"},
+		{"*", "", "1"},
+		{"*", "4294967296 4294967296", "18446744073709551616"},
+		{"*", "-1 -9223372036854775808", "9223372036854775808"},
+		{"*", "18446744073709551616 0", "0"},
+		{"/", "7 2", "3"},
+		{"/", "-7 2", "-3"},
+		{"/", "18446744073709551616 4294967296", "4294967296"},
+		{"/", "-9223372036854775808 -1", "9223372036854775808"},
+		{"/", "1 0", "error: / by zero"},
+		{"/", "0", "error: / by zero"},
+		{"/", "2", "0"},
+		{"+", `1 "a"`, "error: non-integer found"},
+		{"inc", "9223372036854775807", "9223372036854775808"},
+		{"dec", "-9223372036854775808", "-9223372036854775809"},
+		{"dec", "9223372036854775808", "9223372036854775807"},
+		{"abs", "-9223372036854775809", "9223372036854775809"},
+		{"<", "1 9223372036854775808", "true"},
+		{"<", "-9223372036854775809 -9223372036854775808 0", "true"},
+		{">", "9223372036854775809 9223372036854775808", "true"},
+		{">", "-9223372036854775808 9223372036854775807", "false"},
+		{"<=", "9223372036854775808 9223372036854775808", "true"},
+		{"=", "9223372036854775808 9223372036854775808", "true"},
+		{"=", "9223372036854775807 9223372036854775808", "false"},
+		{"max", "1 9223372036854775808 3", "9223372036854775808"},
+		{"number?", "9223372036854775808", "true"},
+	})
+}
+
+func TestUnicodeStrings(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"count", `"héllo"`, "5"},
+		{"count", `"a😀b"`, "3"},
+		{"count", "\"e\u0301x\"", "3"},
+		{"nth", `"a😀b" 1`, `\😀`},
+		{"nth", `"a😀b" 2`, `\b`},
+		{"nth", "\"e\u0301x\" 2", `\x`},
+		{"subs", `"a😀b" 1`, `"😀b"`},
+		{"subs", `"a😀b" 1 2`, `"😀"`},
+		{"subs", "\"e\u0301x\" 0 2", "\"e\u0301\""},
+		{"subs", `"😀😀" 2`, `""`},
+		{"subs", `"😀😀" 3`, "error: subs index out of range"},
+		{"first", `"😀b"`, `\😀`},
+		{"last", `"a😀"`, `\😀`},
+	})
+}
+
+func TestFnArgs(t *testing.T) {
+	env := BuildEnv()
+	macro := types.Function{Fn: func(args ...types.MalType) (types.MalType, error) { return types.Nil{}, nil }, IsMacro: true}
+	identity := types.Function{Fn: func(args ...types.MalType) (types.MalType, error) { return args[0], nil }}
+	tests := []struct {
+		name     string
+		args     []types.MalType
+		expected string
+	}{
+		{"map", []types.MalType{types.Integer(1), types.NewList()}, "map requires a fn value"},
+		{"map", []types.MalType{macro, types.NewList()}, "can't take value of a macro"},
+		{"map", []types.MalType{identity, types.Range{Step: 1}}, "map requires a finite seq"},
+		{"apply", []types.MalType{types.Integer(1), types.NewList()}, "apply requires a fn value"},
+		{"apply", []types.MalType{macro, types.NewList()}, "can't take value of a macro"},
+		{"reduce", []types.MalType{types.Nil{}, types.NewList()}, "reduce requires a fn value"},
+		{"every?", []types.MalType{macro, types.NewList()}, "can't take value of a macro"},
+		{"sort-by", []types.MalType{types.String("a"), types.NewList()}, "sort-by requires a fn value"},
+	}
+	for _, test := range tests {
+		value, err := env.Get(test.name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = value.(types.Function).Fn(test.args...)
+		if err == nil || err.Error() != test.expected {
+			t.Errorf("%s: expected %s, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func TestSlurpFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glimpse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := strconv.Quote(filepath.Join(dir, "out.txt"))
+	missing := filepath.Join(dir, "missing.txt")
+	callTests(t, BuildEnv(), []callTest{
+		{"spit", path + ` "héllo\nworld"`, "nil"},
+		{"slurp", path, `"héllo\nworld"`},
+		{"spit", path + " [1 :a]", "nil"},
+		{"slurp", path, `"[1 :a]"`},
+		{"slurp", strconv.Quote(missing), "error: open " + missing + ": no such file or directory"},
+		{"slurp", "1", "error: slurp requires a string arg"},
+		{"spit", strconv.Quote(filepath.Join(dir, "no", "such", "dir")) + ` "x"`, "error: open " + filepath.Join(dir, "no", "such", "dir") + ": no such file or directory"},
+	})
+}
+
+func TestSlurpStdin(t *testing.T) {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdin := os.Stdin
+	os.Stdin = r
+	defer func() { os.Stdin = stdin }()
+	go func() {
+		w.WriteString("(+ 1 2)\n")
+		w.Close()
+	}()
+	callTests(t, BuildEnv(), []callTest{
+		{"slurp", `"-"`, `"(+ 1 2)\n"`},
+	})
+	r.Close()
+}
+
+func TestSlurpURLs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/found":
+			w.Write([]byte("found"))
+		case "/slow":
+			time.Sleep(100 * time.Millisecond)
+			w.Write([]byte("slow"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	timeout := slurpTimeout
+	slurpTimeout = 10 * time.Millisecond
+	defer func() { slurpTimeout = timeout }()
+	env := BuildEnv()
+	callTests(t, env, []callTest{
+		{"slurp", strconv.Quote(server.URL + "/found"), `"found"`},
+		{"slurp", strconv.Quote(server.URL + "/missing"), "error: slurp of " + server.URL + "/missing failed: 404 Not Found"},
+	})
+	if _, err := call(env, "slurp", strconv.Quote(server.URL+"/slow")); err == nil {
+		t.Error("slurp of a slow url did not time out")
+	}
+}
+
+func TestCounter(t *testing.T) {
+	env := BuildEnv()
+	callTests(t, env, []callTest{
+		{"counter", "1", "error: counter requires 0 args"},
+	})
+	value, err := call(env, "counter", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := value.(types.Function)
+	for i := 1; i <= 3; i++ {
+		n, err := next.Fn()
+		if err != nil || n != types.Integer(i) {
+			t.Errorf("call %d returned %v, %v", i, n, err)
+		}
+	}
+}
+
+func TestCounterConcurrently(t *testing.T) {
+	value, err := call(BuildEnv(), "counter", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := value.(types.Function)
+	const goroutines, calls = 16, 1000
+	seen := make([][]types.MalType, goroutines)
+	var wg sync.WaitGroup
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < calls; i++ {
+				n, _ := next.Fn()
+				seen[g] = append(seen[g], n)
+			}
+		}(g)
+	}
+	wg.Wait()
+	counts := make(map[types.MalType]int)
+	for _, ns := range seen {
+		for _, n := range ns {
+			counts[n]++
+		}
+	}
+	if len(counts) != goroutines*calls {
+		t.Errorf("%d distinct values from %d calls", len(counts), goroutines*calls)
+	}
+	for i := 1; i <= goroutines*calls; i++ {
+		if counts[types.Integer(i)] != 1 {
+			t.Errorf("%d returned %d times", i, counts[types.Integer(i)])
+		}
+	}
+	last, _ := next.Fn()
+	if last != types.Integer(goroutines*calls+1) {
+		t.Errorf("final count %v", last)
+	}
+}
+
+func TestInternKeyword(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"intern-keyword", `"a"`, ":a"},
+		{"intern-keyword", `"ns/a"`, ":ns/a"},
+		{"intern-keyword", ":a", "error: intern-keyword requires a string arg"},
+		{"intern-keyword", "", "error: intern-keyword requires 1 arg"},
+		{"identical?", ":a :a", "true"},
+		{"identical?", "a a", "true"},
+		{"identical?", ":a :b", "false"},
+		{"identical?", ":a a", "false"},
+		{"=", ":a :a :a", "true"},
+		{"=", ":a :a :b", "false"},
+	})
+	env := BuildEnv()
+	interned, err := call(env, "intern-keyword", `"a"`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	identical, err := env.Get("identical?")
+	if err != nil {
+		t.Fatal(err)
+	}
+	same, err := identical.(types.Function).Fn(interned, types.NewKeyword("a"))
+	if err != nil || same != types.Boolean(true) {
+		t.Errorf("interned keyword is not identical to a read keyword: %v", err)
+	}
+}
+
+func TestButlastAndDropLast(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"butlast", "[1 2 3]", "(1 2)"},
+		{"butlast", "(1 2)", "(1)"},
+		{"butlast", "[1]", "()"},
+		{"butlast", "[]", "()"},
+		{"butlast", "nil", "()"},
+		{"butlast", `"abc"`, `(\a \b)`},
+		{"butlast", "", "error: butlast requires 1 arg"},
+		{"drop-last", "[1 2 3]", "(1 2)"},
+		{"drop-last", "0 [1 2 3]", "(1 2 3)"},
+		{"drop-last", "2 [1 2 3]", "(1)"},
+		{"drop-last", "3 [1 2 3]", "()"},
+		{"drop-last", "5 (1 2 3)", "()"},
+		{"drop-last", "1 []", "()"},
+		{"drop-last", "-1 [1]", "error: drop-last requires a non-negative count"},
+		{"drop-last", ":a [1]", "error: drop-last requires an integer count"},
+		{"drop-last", "", "error: drop-last requires 1 or 2 args"},
+	})
+}
+
+func TestGetInDefault(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"get-in", "{:a {:b 1}} [:a :b] :missing", "1"},
+		{"get-in", "{:a {:b 1}} [:a :c] :missing", ":missing"},
+		{"get-in", "{:a {:b 1}} [:x :b] :missing", ":missing"},
+		{"get-in", "{:a 1} [:a :b] :missing", ":missing"},
+		{"get-in", "{:a {:b nil}} [:a :b] :missing", "nil"},
+		{"get-in", "{:a {:b false}} [:a :b] :missing", "false"},
+		{"get-in", "{:a {:b 1}} [] :missing", "{:a {:b 1}}"},
+		{"get-in", "nil [:a] :missing", ":missing"},
+		{"get-in", "{:a {:b 1}} [:a :c]", "nil"},
+	})
+}
+
+func TestFrequencies(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"frequencies", `"aab"`, `{\a 2 \b 1}`},
+		{"frequencies", "[]", "{}"},
+		{"frequencies", "nil", "{}"},
+		{"frequencies", `""`, "{}"},
+		{"frequencies", "[:a :b :a :a]", "{:a 3 :b 1}"},
+		{"frequencies", "[[1 2] (1 2) [2 1]]", "{[1 2] 2 [2 1] 1}"},
+		{"frequencies", `[1 "1" \1 :1]`, `{1 1 "1" 1 \1 1 :1 1}`},
+		{"frequencies", "[nil nil false]", "{nil 2 false 1}"},
+		{"frequencies", "", "error: frequencies requires 1 arg"},
+	})
+}
+
+func TestAtomArities(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"atom", "", "error: atom requires 1 arg"},
+		{"atom", "1 2", "error: atom requires 1 arg"},
+		{"atom?", "", "error: atom? requires 1 arg"},
+		{"atom?", "1 2", "error: atom? requires 1 arg"},
+		{"atom?", "1", "false"},
+		{"deref", "", "error: deref requires 1 or 3 args"},
+		{"deref", "1 2", "error: deref requires 1 or 3 args"},
+		{"deref", "1", "error: deref requires a derefable value"},
+		{"reset!", "", "error: reset! requires 2 args"},
+		{"reset!", "1", "error: reset! requires 2 args"},
+		{"reset!", "1 2 3", "error: reset! requires 2 args"},
+		{"reset!", "1 2", "error: reset! requires an atom value"},
+	})
+}
+
+func TestParseInt(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"parse-int", `"42"`, "42"},
+		{"parse-int", `"-42"`, "-42"},
+		{"parse-int", `"+7"`, "7"},
+		{"parse-int", `"ff" 16`, "255"},
+		{"parse-int", `"FF" 16`, "255"},
+		{"parse-int", `"-101" 2`, "-5"},
+		{"parse-int", `"9223372036854775807"`, "9223372036854775807"},
+		{"parse-int", `"9223372036854775808"`, `error: parse-int could not parse "9223372036854775808"`},
+		{"parse-int", `"12x"`, `error: parse-int could not parse "12x"`},
+		{"parse-int", `""`, `error: parse-int could not parse ""`},
+		{"parse-int", `"0x1f"`, `error: parse-int could not parse "0x1f"`},
+		{"parse-int", `"g" 16`, `error: parse-int could not parse "g"`},
+		{"parse-int", `"1" 1`, `error: parse-int could not parse "1"`},
+		{"parse-int", `"1" :a`, "error: parse-int requires an integer radix"},
+		{"parse-int", "1", "error: parse-int requires a string arg"},
+		{"parse-int", "", "error: parse-int requires 1 or 2 args"},
+	})
+}
+
+func TestJoinAndSplit(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"join", `", " [1 "a" :b \c nil]`, `"1, a, :b, c, nil"`},
+		{"join", `"" ["a" "b"]`, `"ab"`},
+		{"join", `"-" []`, `""`},
+		{"join", `"-" nil`, `""`},
+		{"join", `"-" ["a"]`, `"a"`},
+		{"join", `"-" [[1 "a"] {:k "v"}]`, `"[1 a]-{:k v}"`},
+		{"join", `"-" "abc"`, `"a-b-c"`},
+		{"join", `1 [1 2]`, "error: join requires a string separator"},
+		{"join", `"-"`, "error: join requires 2 args"},
+		{"split", `"a,b,c" ","`, `["a" "b" "c"]`},
+		{"split", `"a, b" ", "`, `["a" "b"]`},
+		{"split", `"a,,b," ","`, `["a" "" "b" ""]`},
+		{"split", `"abc" ","`, `["abc"]`},
+		{"split", `"" ","`, "[]"},
+		{"split", `"a😀b" ""`, `["a" "😀" "b"]`},
+		{"split", `1 ","`, "error: split requires a string arg"},
+		{"split", `"a" 1`, "error: split requires a string separator"},
+		{"split", `"a"`, "error: split requires 2 args"},
+	})
+}
+
+func TestStringCase(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"upper-case", `"abc"`, `"ABC"`},
+		{"upper-case", `"éλ😀"`, `"ÉΛ😀"`},
+		{"upper-case", `""`, `""`},
+		{"lower-case", `"ABC"`, `"abc"`},
+		{"lower-case", `"ÉΛΣ"`, `"éλσ"`},
+		{"trim", `"  a b  "`, `"a b"`},
+		{"trim", "\"\t\na\n\"", `"a"`},
+		{"trim", "\" a　\"", `"a"`},
+		{"trim", `"   "`, `""`},
+		{"upper-case", ":a", "error: upper-case requires a string arg"},
+		{"lower-case", "nil", "error: lower-case requires a string arg"},
+		{"trim", `\a`, "error: trim requires a string arg"},
+		{"trim", `"a" "b"`, "error: trim requires 1 arg"},
+	})
+}
+
+func TestReplace(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"replace", `"abc" "x" "y"`, `"abc"`},
+		{"replace", `"abc" "b" "B"`, `"aBc"`},
+		{"replace", `"a-b-c" "-" ", "`, `"a, b, c"`},
+		{"replace", `"aaa" "aa" "b"`, `"ba"`},
+		{"replace", `"ab" "a" "aa"`, `"aab"`},
+		{"replace", `"a😀b😀" "😀" ""`, `"ab"`},
+		{"replace", `"" "a" "b"`, `""`},
+		{"replace", `"abc" "" "x"`, "error: replace requires a non-empty match"},
+		{"replace", `"abc" :b "x"`, "error: replace requires string args"},
+		{"replace", `"abc" "b"`, "error: replace requires 3 args"},
+	})
+}
+
+func TestStringPredicates(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"starts-with?", `"hello" "he"`, "true"},
+		{"starts-with?", `"hello" "lo"`, "false"},
+		{"starts-with?", `"hello" ""`, "true"},
+		{"starts-with?", `"" ""`, "true"},
+		{"starts-with?", `"he" "hello"`, "false"},
+		{"ends-with?", `"hello" "lo"`, "true"},
+		{"ends-with?", `"hello" "he"`, "false"},
+		{"ends-with?", `"hello" ""`, "true"},
+		{"includes?", `"hello" "ell"`, "true"},
+		{"includes?", `"hello" "xyz"`, "false"},
+		{"includes?", `"hello" ""`, "true"},
+		{"includes?", `"a😀b" "😀"`, "true"},
+		{"starts-with?", `:hello "he"`, "error: starts-with? requires a string arg"},
+		{"ends-with?", `"hello" \o`, "error: ends-with? requires a string arg"},
+		{"includes?", `"hello"`, "error: includes? requires 2 args"},
+	})
+}
+
+func TestFormat(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"format", `"plain"`, `"plain"`},
+		{"format", `"%s!" "hi"`, `"hi!"`},
+		{"format", `"%s" [1 "a" :b]`, `"[1 a :b]"`},
+		{"format", `"%v" "hi"`, `"\"hi\""`},
+		{"format", `"%v" [1 "a" :b]`, `"[1 \"a\" :b]"`},
+		{"format", `"%d items" 3`, `"3 items"`},
+		{"format", `"%d" 9223372036854775808`, `"9223372036854775808"`},
+		{"format", `"100%%"`, `"100%"`},
+		{"format", `"%s=%d (%v)" :x 1 nil`, `":x=1 (nil)"`},
+		{"format", `"%s😀%s" "a" "b"`, `"a😀b"`},
+		{"format", `"%d" "1"`, "error: format %d requires an integer arg"},
+		{"format", `"%s %s" 1`, "error: format has too few args"},
+		{"format", `"%s" 1 2`, "error: format has too many args"},
+		{"format", `"" 1`, "error: format has too many args"},
+		{"format", `"%x" 1`, "error: format has an invalid directive: %x"},
+		{"format", `"50%"`, "error: format string ends with an incomplete directive"},
+		{"format", "", "error: format requires at least 1 arg"},
+	})
+}
+
+func TestNameAndNamespace(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"name", ":foo/bar", `"bar"`},
+		{"name", ":bar", `"bar"`},
+		{"name", "foo/bar", `"bar"`},
+		{"name", "bar", `"bar"`},
+		{"name", "/", `"/"`},
+		{"name", "a/b/c", `"b/c"`},
+		{"namespace", ":foo/bar", `"foo"`},
+		{"namespace", ":bar", "nil"},
+		{"namespace", "foo/bar", `"foo"`},
+		{"namespace", "bar", "nil"},
+		{"namespace", "/", "nil"},
+		{"namespace", "a/b/c", `"a"`},
+		{"namespace", `"foo/bar"`, "error: namespace requires a keyword or symbol"},
+		{"namespace", "", "error: namespace requires 1 arg"},
+	})
+}
+
+func TestName(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"name", ":id", `"id"`},
+		{"name", "id", `"id"`},
+		{"name", `"id"`, `"id"`},
+		{"name", `""`, `""`},
+		{"name", `"foo/bar"`, `"foo/bar"`},
+		{"name", "1", "error: name requires a keyword, symbol, or string"},
+		{"name", "nil", "error: name requires a keyword, symbol, or string"},
+		{"name", "", "error: name requires 1 arg"},
+		{"name", ":a :b", "error: name requires 1 arg"},
+	})
+}
+
+func TestAssocIn(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"assoc-in", "{:a {:b 1}} [:a :b] 2", "{:a {:b 2}}"},
+		{"assoc-in", "{:a {:b {:c {:d 1}}}} [:a :b :c :d] 2", "{:a {:b {:c {:d 2}}}}"},
+		{"assoc-in", "{:a {:b 1}} [:a :c] 2", "{:a {:b 1 :c 2}}"},
+		{"assoc-in", "{} [:a :b :c] 1", "{:a {:b {:c 1}}}"},
+		{"assoc-in", "{:x 1} [:a :b] 1", "{:x 1 :a {:b 1}}"},
+		{"assoc-in", "nil [:a :b] 1", "{:a {:b 1}}"},
+		{"assoc-in", "{:a {:b 1}} [:a] 2", "{:a 2}"},
+		{"assoc-in", "{:a nil} [:a :b] 1", "{:a {:b 1}}"},
+		{"assoc-in", "{} [:a]", "error: assoc-in requires 3 args"},
+	})
+}
+
+func TestCharPredicate(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"char?", `\a`, "true"},
+		{"char?", `\newline`, "true"},
+		{"char?", `\é`, "true"},
+		{"char?", `"a"`, "false"},
+		{"char?", "a", "false"},
+		{"char?", "97", "false"},
+		{"char?", "nil", "false"},
+		{"char?", "", "error: char? requires 1 arg"},
+		{"type", `\a`, ":char"},
+		{"type", `\space`, ":char"},
+		{"type", `"a"`, ":string"},
+	})
+}
+
+func TestSelectKeys(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"select-keys", "{:a 1 :b 2 :c 3} [:a :c]", "{:a 1 :c 3}"},
+		{"select-keys", "{:a 1 :b 2} [:a :x]", "{:a 1}"},
+		{"select-keys", "{:a 1 :b nil} [:b]", "{:b nil}"},
+		{"select-keys", "{:a 1} []", "{}"},
+		{"select-keys", "{:a 1} ()", "{}"},
+		{"select-keys", "{} [:a]", "{}"},
+		{"select-keys", "nil [:a]", "{}"},
+		{"select-keys", "[1 2] [0]", "error: select-keys requires a map"},
+		{"select-keys", "{:a 1}", "error: select-keys requires 2 args"},
+	})
+}
+
+func TestZipmap(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"zipmap", "[:a :b] [1 2]", "{:a 1 :b 2}"},
+		{"zipmap", "[:a :b :c] [1 2]", "{:a 1 :b 2}"},
+		{"zipmap", "[:a] [1 2]", "{:a 1}"},
+		{"zipmap", "[:a :b :a] [1 2 3]", "{:a 3 :b 2}"},
+		{"zipmap", "[] [1 2]", "{}"},
+		{"zipmap", "[:a] []", "{}"},
+		{"zipmap", "nil nil", "{}"},
+		{"zipmap", "(:a :b) \"xy\"", `{:a \x :b \y}`},
+		{"zipmap", "[:a]", "error: zipmap requires 2 args"},
+	})
+}
+
+func TestNotEquals(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"not=", "1 1", "false"},
+		{"not=", "1 2", "true"},
+		{"not=", "1", "false"},
+		{"not=", "1 1 1", "false"},
+		{"not=", "1 1 2", "true"},
+		{"not=", "2 1 1", "true"},
+		{"not=", "[1 2] (1 2)", "false"},
+		{"not=", "{:a 1} {:a 1}", "false"},
+		{"not=", "nil false", "true"},
+		{"not=", `"a" \a`, "true"},
+		{"not", "nil", "true"},
+		{"not", "false", "true"},
+		{"not", "0", "false"},
+		{"not", `""`, "false"},
+		{"not", "", "error: not requires 1 arg"},
+	})
+}
+
+func TestBoolean(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"boolean", "nil", "false"},
+		{"boolean", "false", "false"},
+		{"boolean", "true", "true"},
+		{"boolean", "0", "true"},
+		{"boolean", `""`, "true"},
+		{"boolean", "()", "true"},
+		{"boolean", "{}", "true"},
+		{"boolean", ":false", "true"},
+		{"boolean", "", "error: boolean requires 1 arg"},
+		{"boolean", "nil nil", "error: boolean requires 1 arg"},
+	})
+}
+
+func TestOddArgErrors(t *testing.T) {
+	callTests(t, BuildEnv(), []callTest{
+		{"hash-map", ":a", "error: hash-map requires an even number of args, got 1"},
+		{"hash-map", ":a 1 :b", "error: hash-map requires an even number of args, got 3"},
+		{"hash-map", "", "{}"},
+		{"hash-map", ":a 1", "{:a 1}"},
+		{"assoc", "{} :a", "error: assoc requires an even number of key and value args, got 1"},
+		{"assoc", "{} :a 1 :b", "error: assoc requires an even number of key and value args, got 3"},
+		{"assoc", "nil :a", "error: assoc requires an even number of key and value args, got 1"},
+		{"assoc", "{} :a 1", "{:a 1}"},
+		{"assoc", "", "error: assoc requires at least 1 arg"},
+		{"assoc", "[] :a 1", "error: assoc requires a map or nil"},
+	})
+}
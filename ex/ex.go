@@ -11,6 +11,12 @@ type Ex struct {
 
 func (ex Ex) Unwrap() error { return ex.Err }
 
+// Is matches any ex with the same code, so codes may serve as sentinels
+func (ex Ex) Is(target error) bool {
+	that, valid := target.(Ex)
+	return valid && ex.Code == that.Code
+}
+
 func (ex Ex) String() string {
 	return fmt.Sprintf("error: %v: %v: %v", ex.Code, ex.Err, ex.Context)
 }
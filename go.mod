@@ -4,6 +4,6 @@ go 1.14
 
 require (
 	github.com/benbjohnson/immutable v0.2.0
-	github.com/peterh/liner v1.2.0 // indirect
+	github.com/peterh/liner v1.2.0
 	github.com/spaolacci/murmur3 v1.1.0
 )
@@ -2,12 +2,21 @@ package main
 
 import (
 	"bufio"
+	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"io"
+	"io/ioutil"
 	"log"
 	"os"
+	"os/signal"
 	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/benbjohnson/immutable"
 	"github.com/dball/glimpse/core"
@@ -18,7 +27,7 @@ import (
 	"github.com/peterh/liner"
 )
 
-func evalAst(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
+func (interp *Interpreter) evalAst(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
 	switch value := form.(type) {
 	case types.Symbol:
 		v, err := evalEnv.Get(value.Name)
@@ -31,7 +40,7 @@ func evalAst(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
 		itr := value.Imm.Iterator()
 		for !itr.Done() {
 			i, v := itr.Next()
-			item, err := EVAL(evalEnv, v)
+			item, err := interp.EVAL(evalEnv, v)
 			if err != nil {
 				return nil, err
 			}
@@ -43,7 +52,7 @@ func evalAst(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
 		itr := value.Imm.Iterator()
 		for !itr.Done() {
 			i, v := itr.Next()
-			item, err := EVAL(evalEnv, v)
+			item, err := interp.EVAL(evalEnv, v)
 			if err != nil {
 				return nil, err
 			}
@@ -51,30 +60,28 @@ func evalAst(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
 		}
 		return types.NewVector(items...), nil
 	case types.Map:
-		itr := value.Imm.Iterator()
+		keys, vals := value.Entries()
 		m2 := types.NewMap()
-		b := immutable.NewMapBuilder(m2.Imm)
-		for !itr.Done() {
-			k, v := itr.Next()
-			k2, err := EVAL(evalEnv, k)
+		for i, k := range keys {
+			k2, err := interp.EVAL(evalEnv, k)
 			if err != nil {
 				return nil, err
 			}
-			v2, err := EVAL(evalEnv, v)
+			v2, err := interp.EVAL(evalEnv, vals[i])
 			if err != nil {
 				return nil, err
 			}
-			b.Set(k2, v2)
+			m2 = m2.Assoc(k2, v2)
 		}
-		return types.Map{Imm: b.Map()}, nil
+		return m2, nil
 	default:
 		return value, nil
 	}
 }
 
-// READ reads
-func READ(s string) (types.MalType, error) {
-	return reader.ReadStr(s)
+// READ reads with the options of the reader vars bound in env
+func READ(env *types.Env, s string) (types.MalType, error) {
+	return reader.ReadStrWithOptions(s, core.ReaderOptions(env))
 }
 
 func isPair(form types.MalType) bool {
@@ -89,8 +96,24 @@ func isPair(form types.MalType) bool {
 	return (err == nil) && !bool(empty)
 }
 
-func quasiquote(form types.MalType) types.MalType {
+// quasiquote expands a quasiquoted form. Symbols ending in # are replaced by
+// generated symbols, the same for each occurrence within the form, so macros
+// may bind names that cannot capture their callers' names.
+//
+// TODO qualify resolvable symbols with their namespace, as Clojure's
+// syntax-quote does, once namespaces exist. Until then every symbol
+// resolves in the one user env, so qualifying them would only break
+// their lookup.
+func quasiquote(form types.MalType, gensyms map[string]types.Symbol) types.MalType {
 	if !isPair(form) {
+		if symbol, valid := form.(types.Symbol); valid && len(symbol.Name) > 1 && strings.HasSuffix(symbol.Name, "#") {
+			gensym, found := gensyms[symbol.Name]
+			if !found {
+				gensym = core.Gensym(strings.TrimSuffix(symbol.Name, "#") + "__")
+				gensyms[symbol.Name] = gensym
+			}
+			form = gensym
+		}
 		return types.NewList(types.NewSymbol("quote"), form)
 	}
 	seq, _ := runtime.Seq(form)
@@ -106,10 +129,121 @@ func quasiquote(form types.MalType) types.MalType {
 		isymbol, valid := ihead.(types.Symbol)
 		if valid && isymbol.Name == "splice-unquote" {
 			_, iihead, _ := itail.Next()
-			return types.NewList(types.NewSymbol("concat"), iihead, quasiquote(tail))
+			return types.NewList(types.NewSymbol("concat"), iihead, quasiquote(tail, gensyms))
+		}
+	}
+	return types.NewList(types.NewSymbol("cons"), quasiquote(head, gensyms), quasiquote(tail, gensyms))
+}
+
+// expandFor expands a for comprehension's binding clauses into nested maps
+// over fns whose results are concatenated. The :when and :let modifiers
+// filter and bind within the enclosing iteration. Like map, the comprehension
+// is eager, so it rejects infinite seqs, e.g. (range), rather than hanging.
+func expandFor(args ...types.MalType) (types.MalType, error) {
+	if len(args) != 2 {
+		return nil, errors.New("for requires 2 args")
+	}
+	bindings, valid := args[0].(types.Vector)
+	if !valid {
+		return nil, errors.New("for requires a vector of bindings")
+	}
+	clauses, err := runtime.IntoSlice(bindings)
+	if err != nil {
+		return nil, err
+	}
+	if len(clauses)%2 != 0 {
+		return nil, errors.New("for requires an even number of binding forms")
+	}
+	form := types.MalType(types.NewList(types.NewSymbol("list"), args[1]))
+	for i := len(clauses) - 2; i >= 0; i -= 2 {
+		switch clauses[i] {
+		case types.NewKeyword("when"):
+			form = types.NewList(types.NewSymbol("if"), clauses[i+1], form, types.NewList(types.NewSymbol("list")))
+		case types.NewKeyword("let"):
+			form = types.NewList(types.NewSymbol("let*"), clauses[i+1], form)
+		default:
+			switch clauses[i].(type) {
+			case types.Symbol, types.Vector, types.Map:
+			default:
+				return nil, errors.New("for binding requires a symbol, vector, or map")
+			}
+			fn := types.NewList(types.NewSymbol("fn*"), types.NewVector(clauses[i]), form)
+			form = types.NewList(types.NewSymbol("apply"), types.NewSymbol("concat"),
+				types.NewList(types.NewSymbol("map"), fn, clauses[i+1]))
+		}
+	}
+	return form, nil
+}
+
+// expandThreading builds a threading macro which inserts each form's result
+// into the next form, as its first arg or, if last is true, its last arg.
+// Forms which are not lists are called with the result as their only arg.
+func expandThreading(name string, last bool) func(args ...types.MalType) (types.MalType, error) {
+	return func(args ...types.MalType) (types.MalType, error) {
+		if len(args) < 1 {
+			return nil, errors.New(name + " requires at least 1 arg")
+		}
+		result := args[0]
+		for _, form := range args[1:] {
+			list, valid := form.(types.List)
+			if !valid {
+				result = types.NewList(form, result)
+				continue
+			}
+			items, err := runtime.IntoSlice(list)
+			if err != nil {
+				return nil, err
+			}
+			if len(items) == 0 {
+				return nil, errors.New(name + " requires non-empty forms")
+			}
+			if last {
+				items = append(items, result)
+			} else {
+				items = append([]types.MalType{items[0], result}, items[1:]...)
+			}
+			result = types.NewList(items...)
+		}
+		return result, nil
+	}
+}
+
+// expandCase expands a case form into a case* dispatch over a map of test
+// constants to result forms, so matching is a single hash lookup rather than
+// a chain of comparisons. Lists of constants share a result form.
+func expandCase(args ...types.MalType) (types.MalType, error) {
+	if len(args) < 1 {
+		return nil, errors.New("case requires an expression")
+	}
+	clauses := args[1:]
+	b := immutable.NewMapBuilder(types.NewMap().Imm)
+	set := func(constant, result types.MalType) error {
+		if _, found := b.Get(constant); found {
+			return errors.New("case has a duplicate test constant")
+		}
+		b.Set(constant, result)
+		return nil
+	}
+	for i := 0; i+1 < len(clauses); i += 2 {
+		if constants, valid := clauses[i].(types.List); valid {
+			items, err := runtime.IntoSlice(constants)
+			if err != nil {
+				return nil, err
+			}
+			for _, constant := range items {
+				if err := set(constant, clauses[i+1]); err != nil {
+					return nil, err
+				}
+			}
+		} else if err := set(clauses[i], clauses[i+1]); err != nil {
+			return nil, err
 		}
 	}
-	return types.NewList(types.NewSymbol("cons"), quasiquote(head), quasiquote(tail))
+	form := []types.MalType{types.NewSymbol("case*"), args[0], types.Map{Imm: b.Map()}}
+	if len(clauses)%2 == 1 {
+		form = append(form, clauses[len(clauses)-1])
+	}
+	return types.NewList(form...), nil
 }
 
 func isMacroCall(evalEnv *types.Env, form types.MalType) (types.Function, types.Seq, bool) {
@@ -138,7 +272,7 @@ func isMacroCall(evalEnv *types.Env, form types.MalType) (types.Function, types.
 	return fn, tail, fn.IsMacro
 }
 
-func macroexpand(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
+func (interp *Interpreter) macroexpand(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
 	for {
 		macro, args, valid := isMacroCall(evalEnv, form)
 		if !valid {
@@ -148,7 +282,17 @@ func macroexpand(evalEnv *types.Env, form types.MalType) (types.MalType, error)
 		if err != nil {
 			return nil, err
 		}
-		expanded, err := macro.Fn(items...)
+		var expanded types.MalType
+		if macro.Body == nil {
+			expanded, err = macro.Fn(items...)
+		} else {
+			// Eval user macro bodies directly so tail calls are trampolined
+			var macroEnv *types.Env
+			macroEnv, err = types.DeriveEnv(macro.Env, macro.Binds, items)
+			if err == nil {
+				expanded, err = interp.EVAL(macroEnv, macro.Body)
+			}
+		}
 		if err != nil {
 			return nil, err
 		}
@@ -156,9 +300,190 @@ func macroexpand(evalEnv *types.Env, form types.MalType) (types.MalType, error)
 	}
 }
 
+// maxMacroexpandDepth bounds the nesting of forms expanded by macroexpand-all
+const maxMacroexpandDepth = 1000
+
+// macroexpandAll expands macros in a form and, recursively, in its subforms.
+// Quoted forms are left as they are.
+func (interp *Interpreter) macroexpandAll(evalEnv *types.Env, form types.MalType, depth int) (types.MalType, error) {
+	if depth > maxMacroexpandDepth {
+		return nil, errors.New("macroexpand-all exceeded the maximum depth")
+	}
+	expanded, err := interp.macroexpand(evalEnv, form)
+	if err != nil {
+		return nil, err
+	}
+	expandItems := func(coll types.MalType) ([]types.MalType, error) {
+		items, err := runtime.IntoSlice(coll)
+		if err != nil {
+			return nil, err
+		}
+		for i, item := range items {
+			item, err = interp.macroexpandAll(evalEnv, item, depth+1)
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return items, nil
+	}
+	switch value := expanded.(type) {
+	case types.Vector:
+		items, err := expandItems(value)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewVector(items...), nil
+	case types.Map:
+		items, err := expandItems(value)
+		if err != nil {
+			return nil, err
+		}
+		var kvs []types.MalType
+		for _, item := range items {
+			entry, _ := runtime.IntoSlice(item)
+			kvs = append(kvs, entry...)
+		}
+		return types.NewMap(kvs...), nil
+	case types.Applicable:
+		if !isPair(value) {
+			return value, nil
+		}
+		seq, _ := runtime.Seq(value)
+		_, head, _ := seq.Next()
+		if symbol, valid := head.(types.Symbol); valid && symbol.Name == "quote" {
+			return value, nil
+		}
+		items, err := expandItems(value)
+		if err != nil {
+			return nil, err
+		}
+		return types.NewList(items...), nil
+	default:
+		return value, nil
+	}
+}
+
+// Limits bound the evaluation of a top-level form. Zero values are unlimited.
+type Limits struct {
+	MaxSteps int64
+	MaxDepth int64
+	Timeout  time.Duration
+}
+
+// cancelCheckSteps is how many steps EVAL takes between checks for cancellation
+const cancelCheckSteps = 1024
+
+var (
+	// ErrStepLimit is returned when an evaluation exceeds its maximum steps
+	ErrStepLimit = errors.New("evaluation exceeded the maximum number of steps")
+	// ErrDepthLimit is returned when an evaluation exceeds its maximum depth
+	ErrDepthLimit = errors.New("evaluation exceeded the maximum depth")
+)
+
+// Interpreter evals forms in its root env within its limits. Each
+// interpreter has its own context and budget of steps, so separate
+// interpreters may eval concurrently, but an interpreter evals one top-level
+// form at a time. Futures eval on their own goroutines within the context and
+// budget of whichever form is being evaluated.
+type Interpreter struct {
+	Env    *types.Env
+	Limits Limits
+	// Progress, if set, is called periodically by eager traversals of long
+	// seqs, e.g. map and reduce, with the number of items traversed so far
+	Progress func(count int)
+	mu       sync.RWMutex
+	ctx      context.Context
+	steps    int64
+	depth    int64
+}
+
+// NewInterpreter builds an interpreter with the given limits over a root env
+// of the core builtins, eval, and the macros and fns bootstrapped in mal
+func NewInterpreter(limits Limits) *Interpreter {
+	interp := &Interpreter{Limits: limits, ctx: context.Background()}
+	interp.Env = interp.buildEnv()
+	return interp
+}
+
+// Eval evals a top-level form within a fresh budget of steps, returning the
+// context's error if it is cancelled or times out first
+func (interp *Interpreter) Eval(ctx context.Context, form types.MalType) (types.MalType, error) {
+	if interp.Limits.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, interp.Limits.Timeout)
+		defer cancel()
+	}
+	interp.setContext(ctx)
+	defer interp.setContext(context.Background())
+	atomic.StoreInt64(&interp.steps, 0)
+	return interp.EVAL(interp.Env, form)
+}
+
+// context returns the context of the form being evaluated
+func (interp *Interpreter) context() context.Context {
+	interp.mu.RLock()
+	defer interp.mu.RUnlock()
+	return interp.ctx
+}
+
+func (interp *Interpreter) setContext(ctx context.Context) {
+	interp.mu.Lock()
+	defer interp.mu.Unlock()
+	interp.ctx = ctx
+}
+
+// limitsFromEnv reads limits from the GLIMPSE_MAX_STEPS, GLIMPSE_MAX_DEPTH,
+// and GLIMPSE_TIMEOUT environment variables
+func limitsFromEnv() (Limits, error) {
+	var l Limits
+	for name, limit := range map[string]*int64{"GLIMPSE_MAX_STEPS": &l.MaxSteps, "GLIMPSE_MAX_DEPTH": &l.MaxDepth} {
+		value := os.Getenv(name)
+		if value == "" {
+			continue
+		}
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || n < 0 {
+			return l, fmt.Errorf("%v must be a non-negative integer", name)
+		}
+		*limit = n
+	}
+	if value := os.Getenv("GLIMPSE_TIMEOUT"); value != "" {
+		timeout, err := time.ParseDuration(value)
+		if err != nil || timeout < 0 {
+			return l, errors.New("GLIMPSE_TIMEOUT must be a non-negative duration")
+		}
+		l.Timeout = timeout
+	}
+	return l, nil
+}
+
+// loopTarget is where a recur in tail position of a loop* jumps
+type loopTarget struct {
+	env   *types.Env
+	binds []types.MalType
+	body  types.MalType
+}
+
 // EVAL evals
-func EVAL(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
+func (interp *Interpreter) EVAL(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
+	// target is only set while evaluating the tail of a loop* in this frame
+	var target *loopTarget
+	depth := atomic.AddInt64(&interp.depth, 1)
+	defer atomic.AddInt64(&interp.depth, -1)
+	if interp.Limits.MaxDepth > 0 && depth > interp.Limits.MaxDepth {
+		return nil, ErrDepthLimit
+	}
 	for {
+		steps := atomic.AddInt64(&interp.steps, 1)
+		if interp.Limits.MaxSteps > 0 && steps > interp.Limits.MaxSteps {
+			return nil, ErrStepLimit
+		}
+		if steps%cancelCheckSteps == 0 {
+			if err := interp.context().Err(); err != nil {
+				return nil, err
+			}
+		}
 		applicable, isApplicable := form.(types.Applicable)
 		if isApplicable {
 			items, err := runtime.IntoSlice(applicable.Seq())
@@ -168,14 +493,14 @@ func EVAL(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
 			if len(items) == 0 {
 				return types.NewList(), nil
 			}
-			expanded, err := macroexpand(evalEnv, types.NewList(items...))
+			expanded, err := interp.macroexpand(evalEnv, types.NewList(items...))
 			if err != nil {
 				return nil, err
 			}
 			form = expanded
 			_, stillApplicable := form.(types.Applicable)
 			if !stillApplicable {
-				return evalAst(evalEnv, form)
+				return interp.evalAst(evalEnv, form)
 			}
 		}
 		switch value := form.(type) {
@@ -187,8 +512,12 @@ func EVAL(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
 			if len(items) == 0 {
 				return value, nil
 			}
-			switch items[0] {
-			case types.Symbol{Name: "def!"}:
+			var special string
+			if symbol, valid := items[0].(types.Symbol); valid {
+				special = symbol.Name
+			}
+			switch special {
+			case "def!":
 				if len(items) != 3 {
 					return nil, errors.New("def! requires 2 args")
 				}
@@ -196,13 +525,17 @@ func EVAL(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
 				if !valid {
 					return nil, errors.New("def! requires a symbol arg")
 				}
-				val, err := EVAL(evalEnv, items[2])
+				val, err := interp.EVAL(evalEnv, items[2])
 				if err != nil {
 					return nil, err
 				}
+				if fn, valid := val.(types.Function); valid && fn.Name == "" {
+					fn.Name = qualifiedName(symbol)
+					val = fn
+				}
 				evalEnv.Set(symbol.Name, val)
 				return val, nil
-			case types.Symbol{Name: "defmacro!"}:
+			case "defmacro!":
 				if len(items) != 3 {
 					return nil, errors.New("defmacro! requires 2 args")
 				}
@@ -210,7 +543,7 @@ func EVAL(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
 				if !valid {
 					return nil, errors.New("defmacro! requires a symbol arg")
 				}
-				val, err := EVAL(evalEnv, items[2])
+				val, err := interp.EVAL(evalEnv, items[2])
 				if err != nil {
 					return nil, err
 				}
@@ -219,9 +552,12 @@ func EVAL(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
 					return nil, errors.New("defmacro! requires a macro arg")
 				}
 				fn.IsMacro = true
+				if fn.Name == "" {
+					fn.Name = qualifiedName(symbol)
+				}
 				evalEnv.Set(symbol.Name, fn)
 				return fn, nil
-			case types.Symbol{Name: "let*"}:
+			case "let*":
 				if len(items) != 3 {
 					return nil, errors.New("let* requires 2 args")
 				}
@@ -237,12 +573,102 @@ func EVAL(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
 				if err != nil {
 					return nil, err
 				}
+				for i := 0; i < len(bindings); i += 2 {
+					val, err := interp.EVAL(inner, bindings[i+1])
+					if err != nil {
+						return nil, err
+					}
+					inner, err = types.DeriveEnv(inner, bindings[i:i+1], []types.MalType{val})
+					if err != nil {
+						return nil, err
+					}
+				}
+				evalEnv = inner
+				form = items[2]
+				continue
+			case "with-redefs":
+				if len(items) < 2 {
+					return nil, errors.New("with-redefs requires a binding arg")
+				}
+				sequential, valid := items[1].(types.Sequential)
+				if !valid {
+					return nil, errors.New("with-redefs requires a binding sequential arg")
+				}
+				bindings, err := runtime.IntoSlice(sequential)
+				if err != nil {
+					return nil, err
+				}
+				if len(bindings)%2 != 0 {
+					return nil, errors.New("with-redefs requires an even list of bindings")
+				}
+				return interp.withRedefs(evalEnv, bindings, append([]types.MalType{types.NewSymbol("do")}, items[2:]...))
+			case "letfn*":
+				if len(items) != 3 {
+					return nil, errors.New("letfn* requires 2 args")
+				}
+				sequential, valid := items[1].(types.Sequential)
+				if !valid {
+					return nil, errors.New("letfn* requires a binding sequential arg")
+				}
+				bindings, err := runtime.IntoSlice(sequential)
+				if err != nil {
+					return nil, err
+				}
+				if len(bindings)%2 != 0 {
+					return nil, errors.New("letfn* requires an even list of bindings")
+				}
+				// The fns close over the inner env, so binding them all after
+				// evaluation lets each refer to any of the others
+				inner, err := types.DeriveEnv(evalEnv, nil, nil)
+				if err != nil {
+					return nil, err
+				}
+				vals := make([]types.MalType, len(bindings)/2)
+				for i := 0; i < len(bindings); i += 2 {
+					if _, valid := bindings[i].(types.Symbol); !valid {
+						return nil, errors.New("letfn* binding arg requires a symbol")
+					}
+					val, err := interp.EVAL(inner, bindings[i+1])
+					if err != nil {
+						return nil, err
+					}
+					if _, valid := val.(types.Function); !valid {
+						return nil, errors.New("letfn* binding value requires a fn")
+					}
+					vals[i/2] = val
+				}
+				for i, val := range vals {
+					inner.Set(bindings[2*i].(types.Symbol).Name, val)
+				}
+				evalEnv = inner
+				form = items[2]
+				continue
+			case "loop*":
+				if len(items) != 3 {
+					return nil, errors.New("loop* requires 2 args")
+				}
+				sequential, valid := items[1].(types.Sequential)
+				if !valid {
+					return nil, errors.New("loop* requires a binding sequential arg")
+				}
+				bindings, err := runtime.IntoSlice(sequential)
+				if err != nil {
+					return nil, err
+				}
+				if len(bindings)%2 != 0 {
+					return nil, errors.New("loop* requires an even list of bindings")
+				}
+				inner, err := types.DeriveEnv(evalEnv, nil, nil)
+				if err != nil {
+					return nil, err
+				}
+				binds := make([]types.MalType, 0, len(bindings)/2)
 				for i := 0; i < len(bindings); i += 2 {
 					symbol, valid := bindings[i].(types.Symbol)
 					if !valid {
-						return nil, errors.New("let* binding arg requires a symbol")
+						return nil, errors.New("loop* binding arg requires a symbol")
 					}
-					val, err := EVAL(inner, bindings[i+1])
+					val, err := interp.EVAL(inner, bindings[i+1])
 					if err != nil {
 						return nil, err
 					}
@@ -250,42 +676,57 @@ func EVAL(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
 					if err != nil {
 						return nil, err
 					}
+					binds = append(binds, symbol)
 				}
+				target = &loopTarget{env: evalEnv, binds: binds, body: items[2]}
 				evalEnv = inner
 				form = items[2]
 				continue
-			case types.Symbol{Name: "do"}:
+			case "recur":
+				if target == nil {
+					return nil, errors.New("recur requires tail position within loop*")
+				}
+				if len(items)-1 != len(target.binds) {
+					return nil, fmt.Errorf("recur requires %d args", len(target.binds))
+				}
+				vals := make([]types.MalType, len(items)-1)
+				for i, item := range items[1:] {
+					val, err := interp.EVAL(evalEnv, item)
+					if err != nil {
+						return nil, err
+					}
+					vals[i] = val
+				}
+				loopEnv, err := types.DeriveEnv(target.env, target.binds, vals)
+				if err != nil {
+					return nil, err
+				}
+				evalEnv = loopEnv
+				form = target.body
+				continue
+			case "do":
 				forms := len(items) - 1
 				if forms == 0 {
 					return types.Nil{}, nil
 				}
 				for _, item := range items[1:forms] {
-					_, err := EVAL(evalEnv, item)
+					_, err := interp.EVAL(evalEnv, item)
 					if err != nil {
 						return nil, err
 					}
 				}
 				form = items[forms]
 				continue
-			case types.Symbol{Name: "if"}:
+			case "if":
 				argl := len(items)
 				if argl < 3 || argl > 4 {
 					return nil, errors.New("if requires 2 or 3 args")
 				}
-				test, err := EVAL(evalEnv, items[1])
+				test, err := interp.EVAL(evalEnv, items[1])
 				if err != nil {
 					return nil, err
 				}
-				var cond bool
-				switch test {
-				case types.Boolean(false):
-					cond = false
-				case types.Nil{}:
-					cond = false
-				default:
-					cond = true
-				}
-				if cond {
+				if runtime.Truthy(test) {
 					form = items[2]
 				} else if argl == 4 {
 					form = items[3]
@@ -293,7 +734,7 @@ func EVAL(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
 					return types.Nil{}, nil
 				}
 				continue
-			case types.Symbol{Name: "fn*"}:
+			case "fn*":
 				if len(items) != 3 {
 					return nil, errors.New("fn* requires 2 args")
 				}
@@ -312,51 +753,105 @@ func EVAL(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
 						if err != nil {
 							return nil, err
 						}
-						return EVAL(fnEnv, body)
+						return interp.EVAL(fnEnv, body)
 					},
 					Body:  body,
 					Binds: binds,
 					Env:   evalEnv,
+					ID:    types.NewFnID(),
 				}, nil
-			case types.Symbol{Name: "quote"}:
+			case "case*":
+				argl := len(items)
+				if argl < 3 || argl > 4 {
+					return nil, errors.New("case* requires 2 or 3 args")
+				}
+				dispatch, valid := items[2].(types.Map)
+				if !valid {
+					return nil, errors.New("case* requires a dispatch map arg")
+				}
+				test, err := interp.EVAL(evalEnv, items[1])
+				if err != nil {
+					return nil, err
+				}
+				result, found := dispatch.Lookup(test)
+				if found {
+					form = result
+				} else if argl == 4 {
+					form = items[3]
+				} else {
+					return nil, errors.New("No matching case clause: " + PRINT(test))
+				}
+				continue
+			case "quote":
 				if len(items) != 2 {
 					return nil, errors.New("quote requires 1 arg")
 				}
 				return items[1], nil
-			case types.Symbol{Name: "quasiquote"}:
-				form = quasiquote(items[1])
+			case "quasiquote":
+				form = quasiquote(items[1], map[string]types.Symbol{})
 				continue
-			case types.Symbol{Name: "macroexpand"}:
-				return macroexpand(evalEnv, items[1])
-			case types.Symbol{Name: "try*"}:
+			case "macroexpand":
+				return interp.macroexpand(evalEnv, items[1])
+			case "macroexpand-all":
+				if len(items) != 2 {
+					return nil, errors.New("macroexpand-all requires 1 arg")
+				}
+				return interp.macroexpandAll(evalEnv, items[1], 0)
+			case "try*":
+				if len(items) < 2 {
+					return nil, errors.New("Invalid try* form")
+				}
 				tryBody := items[1]
-				result, err := EVAL(evalEnv, tryBody)
+				result, err := interp.EVAL(evalEnv, tryBody)
 				if err == nil {
 					return result, nil
 				}
 				if len(items) == 2 {
 					return nil, err
 				}
-				catchForm := items[2]
-				applicable, valid := catchForm.(types.Applicable)
-				if !valid {
-					return nil, errors.New("Invalid try* form")
-				}
-				catchItems, err := runtime.IntoSlice(applicable.Seq())
-				if err != nil {
-					return nil, err
-				}
-				symbol, valid := catchItems[0].(types.Symbol)
-				if !valid || symbol.Name != "catch*" {
-					return nil, errors.New("Invalid try* form")
+				// Thrown values are caught intact, other errors as themselves
+				var caught types.MalType = err
+				var thrown types.MalError
+				if errors.As(err, &thrown) {
+					caught = thrown.Reason
 				}
-				catchEnv, err := types.DeriveEnv(evalEnv, catchItems[1:2], []types.MalType{err})
-				if err != nil {
-					return nil, err
+				// Catch clauses are tried in order, the first matching the error
+				// handling it
+				for _, catchForm := range items[2:] {
+					applicable, valid := catchForm.(types.Applicable)
+					if !valid {
+						return nil, errors.New("Invalid try* form")
+					}
+					catchItems, cerr := runtime.IntoSlice(applicable.Seq())
+					if cerr != nil {
+						return nil, cerr
+					}
+					if len(catchItems) != 3 && len(catchItems) != 4 {
+						return nil, errors.New("Invalid try* form")
+					}
+					symbol, valid := catchItems[0].(types.Symbol)
+					if !valid || symbol.Name != "catch*" {
+						return nil, errors.New("Invalid try* form")
+					}
+					if len(catchItems) == 4 {
+						selector, valid := catchItems[1].(types.Symbol)
+						if !valid {
+							return nil, errors.New("catch* type must be a symbol")
+						}
+						if !catches(selector, err, caught) {
+							continue
+						}
+						catchItems = catchItems[1:]
+					}
+					catchEnv, cerr := types.DeriveEnv(evalEnv, catchItems[1:2], []types.MalType{caught})
+					if cerr != nil {
+						return nil, cerr
+					}
+					return interp.EVAL(catchEnv, catchItems[2])
 				}
-				return EVAL(catchEnv, catchItems[2])
+				return nil, err
 			default:
-				evaluated, err := evalAst(evalEnv, value)
+				evaluated, err := interp.evalAst(evalEnv, value)
 				if err != nil {
 					return nil, err
 				}
@@ -385,71 +880,241 @@ func EVAL(evalEnv *types.Env, form types.MalType) (types.MalType, error) {
 					return nil, err
 				}
 				evalEnv = fnEnv
+				target = nil
 				continue
 			}
 		default:
-			return evalAst(evalEnv, form)
+			return interp.evalAst(evalEnv, form)
 		}
 	}
 }
 
+// withRedefs evaluates a body with top-level vars temporarily set to new
+// values, restoring their values afterward even if the body fails
+func (interp *Interpreter) withRedefs(env *types.Env, bindings []types.MalType, body []types.MalType) (types.MalType, error) {
+	root := env
+	for root.Outer != nil {
+		root = root.Outer
+	}
+	names := make([]types.MalType, 0, len(bindings)/2)
+	vals := make([]types.MalType, 0, len(bindings)/2)
+	for i := 0; i < len(bindings); i += 2 {
+		symbol, valid := bindings[i].(types.Symbol)
+		if !valid {
+			return nil, errors.New("with-redefs binding arg requires a symbol")
+		}
+		if _, found := root.Lookup(symbol.Name); !found {
+			return nil, errors.New("with-redefs requires a defined var: " + symbol.Name)
+		}
+		val, err := interp.EVAL(env, bindings[i+1])
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, symbol)
+		vals = append(vals, val)
+	}
+	for i, name := range names {
+		symbol := name.(types.Symbol)
+		old, _ := root.Lookup(symbol.Name)
+		root.Set(symbol.Name, vals[i])
+		defer root.Set(symbol.Name, old)
+	}
+	inner, err := types.DeriveEnv(env, names, vals)
+	if err != nil {
+		return nil, err
+	}
+	return interp.EVAL(inner, types.NewList(body...))
+}
+
+// catches is true if a catch* clause's type selector matches an error.
+// MalError matches values raised by throw other than errors, which are thrown
+// as themselves. ExInfo matches ex-info values, and other selectors name the
+// type of the caught value, as given by type, e.g. string or error.
+func catches(selector types.Symbol, err error, caught types.MalType) bool {
+	switch selector.Name {
+	case "MalError":
+		var thrown types.MalError
+		return errors.As(err, &thrown)
+	case "ExInfo":
+		_, valid := caught.(types.ExInfo)
+		return valid
+	default:
+		return selector.Name == runtime.Type(caught).Name
+	}
+}
+
+// userNamespace qualifies the names of defined fns, as all definitions share
+// the one namespace
+const userNamespace = "user"
+
+// qualifiedName returns the name of a symbol qualified by its namespace, or
+// the user namespace if it has none
+func qualifiedName(symbol types.Symbol) string {
+	if symbol.Namespace != "" {
+		return symbol.Name
+	}
+	return userNamespace + "/" + symbol.Name
+}
+
 // PRINT prints
 func PRINT(value types.MalType) string {
 	return printer.PrintStr(printer.Config{Readably: true}, value)
 }
 
-func rep(env *types.Env, s string) string {
-	form, err := READ(s)
+func (interp *Interpreter) rep(s string) string {
+	return interp.repContext(context.Background(), s)
+}
+
+func (interp *Interpreter) repContext(ctx context.Context, s string) string {
+	form, err := READ(interp.Env, s)
 	if err != nil {
 		return err.Error()
 	}
-	val, err := EVAL(env, form)
+	val, err := interp.Eval(ctx, form)
 	if err != nil {
 		return "#ERROR: " + PRINT(err)
 	}
-	return PRINT(val)
+	return printer.PrintStr(core.PrintConfig(interp.Env, true), val)
 }
 
-func interactiveRepl2(env *types.Env) {
+// repInterruptibly reps, cancelling the evaluation on an interrupt signal
+func (interp *Interpreter) repInterruptibly(s string) string {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+	go func() {
+		select {
+		case <-interrupts:
+			cancel()
+		case <-ctx.Done():
+		}
+	}()
+	return interp.repContext(ctx, s)
+}
+
+// historyPath returns the repl history file, named by GLIMPSE_HISTORY or else
+// .glimpse_history in the home directory, or the temp directory if there is
+// no home directory
+func historyPath(getenv func(string) string, home func() (string, error)) string {
+	if path := getenv("GLIMPSE_HISTORY"); path != "" {
+		return path
+	}
+	dir, err := home()
+	if err != nil || dir == "" {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, ".glimpse_history")
+}
+
+// appendHistory appends an entry to the history file, creating it if needed
+func appendHistory(historyFile string, entry string) error {
+	if err := os.MkdirAll(filepath.Dir(historyFile), 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(historyFile, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(entry + "\n")
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func interactiveRepl2(interp *Interpreter) {
 	line := liner.NewLiner()
 	defer line.Close()
 	line.SetCtrlCAborts(true)
-	historyFile := filepath.Join(os.TempDir(), ".glimpse-history")
+	historyFile := historyPath(os.Getenv, os.UserHomeDir)
 	if f, err := os.Open(historyFile); err == nil {
 		line.ReadHistory(f)
 		f.Close()
 	}
+	var input inputBuffer
 	for {
-		text, err := line.Prompt("user> ")
+		prompt := "user> "
+		if input.pending() {
+			prompt = "  ...> "
+		}
+		text, err := line.Prompt(prompt)
 		if err == nil {
-			line.AppendHistory(text)
-			os.Stdout.WriteString(rep(env, text))
-			os.Stdout.WriteString("\n")
+			if text, complete := input.add(text); complete {
+				// History is read line by line, so entries are flattened
+				entry := strings.ReplaceAll(text, "\n", " ")
+				line.AppendHistory(entry)
+				appendHistory(historyFile, entry)
+				os.Stdout.WriteString(interp.repInterruptibly(text))
+				os.Stdout.WriteString("\n")
+			}
 		} else if err == liner.ErrPromptAborted {
+			input.reset()
 		} else if err == io.EOF {
 			break
 		} else {
 			log.Fatalf("liner err %v", err)
 		}
-		if f, err := os.Create(historyFile); err == nil {
-			line.WriteHistory(f)
-			f.Close()
-		}
+	}
+	// Rewriting the history on exit trims the appended file to the entries
+	// liner retains
+	if f, err := os.Create(historyFile); err == nil {
+		line.WriteHistory(f)
+		f.Close()
 	}
 }
 
-func main() {
-	env := core.BuildEnv()
+// inputBuffer accumulates lines of repl input until they read as complete
+// forms, so expressions may span lines
+type inputBuffer struct {
+	lines []string
+}
+
+// add buffers a line, returning the buffered text and clearing the buffer
+// once it no longer ends within an unbalanced list
+func (b *inputBuffer) add(line string) (string, bool) {
+	b.lines = append(b.lines, line)
+	text := strings.Join(b.lines, "\n")
+	if _, err := reader.ReadStr(text); errors.Is(err, reader.ErrUnbalanced) {
+		return text, false
+	}
+	b.reset()
+	return text, true
+}
+
+// pending is true if the buffer holds incomplete input
+func (b *inputBuffer) pending() bool {
+	return len(b.lines) > 0
+}
+
+// reset discards any buffered input
+func (b *inputBuffer) reset() {
+	b.lines = nil
+}
+
+// buildEnv builds the root env: the core builtins, eval, and the macros and
+// fns bootstrapped in mal
+func (interp *Interpreter) buildEnv() *types.Env {
+	env := core.BuildEnvWithOptions(core.Options{
+		Progress: func(count int) {
+			if interp.Progress != nil {
+				interp.Progress(count)
+			}
+		},
+		Context: interp.context,
+	})
+	interp.Env = env
 	env.Set("*host-language*", types.String("glimpse"))
-	env.Set("eval", types.Function{
+	env.SetFn("eval", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			if len(args) != 1 {
 				return nil, errors.New("eval requires 1 arg")
 			}
-			return EVAL(env, args[0])
+			return interp.EVAL(env, args[0])
 		},
 	})
-	env.Set("readline", types.Function{
+	env.SetFn("readline", types.Function{
 		Fn: func(args ...types.MalType) (types.MalType, error) {
 			if len(args) != 1 {
 				return nil, errors.New("sad")
@@ -466,25 +1131,136 @@ func main() {
 			return types.String(scanner.Text()), nil
 		},
 	})
-	rep(env, "(def! not (fn* (a) (if a false true)))")
-	rep(env, `(def! load-file (fn* (f) (eval (read-string (str "(do " (slurp f) "\nnil)")))))`)
-	rep(env, `(defmacro! cond (fn* (& xs) (if (> (count xs) 0) (list 'if (first xs) (if (> (count xs) 1) (nth xs 1) (throw "odd number of forms to cond")) (cons 'cond (rest (rest xs)))))))`)
-	var args []types.MalType
-	for _, arg := range os.Args[1:] {
-		args = append(args, types.String(arg))
-	}
-	if len(args) == 0 {
-		env.Set("*ARGV*", types.List{})
-		interactiveRepl2(env)
-	} else {
-		env.Set("*ARGV*", types.NewList(args[1:]...))
-		var items []types.MalType
-		items = append(items, types.Symbol{Name: "load-file"}, args[0])
-		form := types.NewList(items...)
-		_, err := EVAL(env, form)
+	env.SetFn("for", types.Function{Fn: expandFor, IsMacro: true})
+	env.SetFn("case", types.Function{Fn: expandCase, IsMacro: true})
+	env.SetFn("->", types.Function{Fn: expandThreading("->", false), IsMacro: true})
+	env.SetFn("->>", types.Function{Fn: expandThreading("->>", true), IsMacro: true})
+	interp.rep(`(defmacro! cond (fn* (& xs) (if (empty? xs) nil (if (= 1 (count xs)) (throw "cond requires an even number of forms") (list 'if (first xs) (nth xs 1) (cons 'cond (rest (rest xs))))))))`)
+	interp.rep("(defmacro! and (fn* (& xs) (if (empty? xs) true (if (= 1 (count xs)) (first xs) (let* [g (gensym)] (list 'let* [g (first xs)] (list 'if g (cons 'and (rest xs)) g)))))))")
+	interp.rep("(defmacro! or (fn* (& xs) (if (empty? xs) nil (if (= 1 (count xs)) (first xs) (let* [g (gensym)] (list 'let* [g (first xs)] (list 'if g g (cons 'or (rest xs)))))))))")
+	// Loaded code comes only from files, never implicitly from stdin or urls
+	interp.rep(`(def! load-file (fn* (f) (if (or (= f "-") (starts-with? f "http://") (starts-with? f "https://")) (throw (str "load-file requires a file path: " f)) (eval (read-string (str "(do " (slurp f) "\nnil)"))))))`)
+	interp.rep("(defmacro! when (fn* (test & body) (list 'if test (cons 'do body))))")
+	interp.rep("(defmacro! when-not (fn* (test & body) (list 'if test nil (cons 'do body))))")
+	interp.rep("(defmacro! dotimes (fn* (bindings & body) (let* [i (first bindings) n (gensym)] (list 'let* [n (nth bindings 1)] (list 'loop* [i 0] (list 'if (list '< i n) (concat (list 'do) body (list (list 'recur (list 'inc i)))) nil))))))")
+	interp.rep("(defmacro! while (fn* (test & body) (list 'loop* [] (list 'if test (concat (list 'do) body (list (list 'recur))) nil))))")
+	interp.rep("(defmacro! bench (fn* (expr n) (list 'bench* (list 'fn* [] expr) n)))")
+	interp.rep("(defmacro! delay (fn* (& body) (list 'delay* (list 'fn* [] (cons 'do body)))))")
+	interp.rep("(defmacro! future (fn* (& body) (list 'future* (list 'fn* [] (cons 'do body)))))")
+	interp.rep("(defmacro! doseq (fn* (bindings & body) (list 'do (list 'for bindings (cons 'do body)) nil)))")
+	interp.rep(`(defmacro! assert (fn* (x) (list 'when-not x (list 'throw (list 'ex-info (str "Assert failed: " (pr-str x)) (list 'quote {:form x}))))))`)
+	interp.rep("(def! *tests* (atom {}))")
+	interp.rep("(def! *test-report* (atom {}))")
+	interp.rep(`(def! report-test (fn* (result form) (do (swap! *test-report* update result inc) (when-not (= result :pass) (println (if (= result :fail) "FAIL in" "ERROR in") (get @*test-report* :test) (pr-str form))) (= result :pass))))`)
+	interp.rep("(defmacro! is (fn* (form) (list 'try* (list 'report-test (list 'if form :pass :fail) (list 'quote form)) (list 'catch* (gensym) (list 'report-test :error (list 'quote form))))))")
+	interp.rep("(defmacro! deftest (fn* (name & body) (list 'do (list 'def! name (list 'fn* [] (cons 'do body))) (list 'swap! '*tests* 'assoc (list 'quote name) name) (list 'quote name))))")
+	interp.rep(`(def! run-tests (fn* () (let* [totals (atom {:test 0 :pass 0 :fail 0 :error 0})] (do (doseq [name (keys @*tests*)] (do (reset! *test-report* {:test name :pass 0 :fail 0 :error 0}) (try* ((get @*tests* name)) (catch* e (report-test :error (list 'deftest name)))) (swap! totals (fn* [m] (reduce (fn* [acc k] (update acc k + (get @*test-report* k))) (update m :test inc) [:pass :fail :error]))))) (println "Ran" (get @totals :test) "tests:" (get @totals :pass) "passed," (get @totals :fail) "failed," (get @totals :error) "errors.") @totals))))`)
+	return env
+}
+
+func main() {
+	limits, err := limitsFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	interp := NewInterpreter(limits)
+	env := interp.Env
+	inv, err := parseArgs(os.Args[1:])
+	if err != nil {
+		printError(os.Stderr, err)
+		os.Exit(2)
+	}
+	var argv []types.MalType
+	for _, arg := range inv.argv {
+		argv = append(argv, types.String(arg))
+	}
+	env.Set("*ARGV*", types.NewList(argv...))
+	var form types.MalType
+	switch inv.mode {
+	case modeRepl:
+		interactiveRepl2(interp)
+		return
+	case modeFile:
+		form = types.NewList(types.NewSymbol("load-file"), types.String(inv.source))
+	case modeStdin:
+		source, err := ioutil.ReadAll(os.Stdin)
+		if err != nil {
+			log.Fatal(err)
+		}
+		form, err = READ(env, "(do "+string(source)+"\nnil)")
+		if err != nil {
+			printError(os.Stderr, err)
+			os.Exit(1)
+		}
+	case modeEval:
+		form, err = READ(env, "(do "+inv.source+"\n)")
 		if err != nil {
-			os.Stderr.WriteString(fmt.Sprintf("error: %v", err))
+			printError(os.Stderr, err)
 			os.Exit(1)
 		}
 	}
+	result, err := interp.Eval(context.Background(), form)
+	if err != nil {
+		printError(os.Stderr, err)
+		os.Exit(1)
+	}
+	if inv.mode == modeEval {
+		printer.Fprintln(os.Stdout, core.PrintConfig(env, true), result)
+	}
+}
+
+// printError prints an error as the repl does, thrown values readably
+func printError(w io.Writer, err error) {
+	io.WriteString(w, "error: "+PRINT(err)+"\n")
+}
+
+// Invocation modes
+const (
+	modeRepl  = "repl"
+	modeFile  = "file"
+	modeStdin = "stdin"
+	modeEval  = "eval"
+)
+
+// invocation is what the command line asks glimpse to do: start a repl, load
+// a file, read a script from stdin, or evaluate and print an expression
+type invocation struct {
+	mode string
+	// source is the file to load or the expression to evaluate
+	source string
+	// argv are the remaining args, bound to *ARGV*
+	argv []string
+}
+
+// parseArgs dispatches on the command line args: -e expr evaluates expr, -
+// reads a script from stdin, a path loads a file, and no args start a repl
+func parseArgs(args []string) (invocation, error) {
+	flags := flag.NewFlagSet("glimpse", flag.ContinueOnError)
+	flags.SetOutput(ioutil.Discard)
+	expr := flags.String("e", "", "evaluate and print the `expr`")
+	if err := flags.Parse(args); err != nil {
+		return invocation{}, err
+	}
+	rest := flags.Args()
+	switch {
+	case isFlagSet(flags, "e"):
+		return invocation{mode: modeEval, source: *expr, argv: rest}, nil
+	case len(rest) == 0:
+		return invocation{mode: modeRepl}, nil
+	case rest[0] == "-":
+		return invocation{mode: modeStdin, argv: rest[1:]}, nil
+	default:
+		return invocation{mode: modeFile, source: rest[0], argv: rest[1:]}, nil
+	}
+}
+
+// isFlagSet is true if the named flag was given, even with an empty value
+func isFlagSet(flags *flag.FlagSet, name string) bool {
+	set := false
+	flags.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return set
 }
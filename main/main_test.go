@@ -0,0 +1,1286 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dball/glimpse/printer"
+	"github.com/dball/glimpse/types"
+)
+
+// eval reads and evaluates the forms in s, returning the last value
+func eval(interp *Interpreter, s string) (types.MalType, error) {
+	return evalContext(context.Background(), interp, s)
+}
+
+// evalContext reads and evaluates the forms in s within ctx
+func evalContext(ctx context.Context, interp *Interpreter, s string) (types.MalType, error) {
+	form, err := READ(interp.Env, "(do "+s+"\n)")
+	if err != nil {
+		return nil, err
+	}
+	return interp.Eval(ctx, form)
+}
+
+// evalTests evaluates each test's input in a new interpreter and compares the
+// printed result, or the error message if expected is prefixed with error:
+func evalTests(t *testing.T, tests []struct{ input, expected string }) {
+	t.Helper()
+	for _, test := range tests {
+		value, err := eval(NewInterpreter(Limits{}), test.input)
+		var actual string
+		if err != nil {
+			actual = "error: " + PRINT(err)
+		} else {
+			actual = printer.PrintStr(printer.Config{Readably: true}, value)
+		}
+		if actual != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.input, test.expected, actual)
+		}
+	}
+}
+
+func TestSpecialForms(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(def! x 1) x", "1"},
+		{"(let* [x 1 y (+ x 1)] y)", "2"},
+		{"(do 1 2)", "2"},
+		{"(if nil 1 2)", "2"},
+		{"((fn* [x] (* x 2)) 3)", "6"},
+		{"(quote (a b))", "(a b)"},
+		{"(def! x 2) `(x ~x)", "(x 2)"},
+		{"(defmacro! unless (fn* [c x] (list 'if c nil x))) (unless false 1)", "1"},
+		{"(macroexpand (when true 1))", "(if true (do 1))"},
+		{"(loop* [i 0] (if (< i 3) (recur (inc i)) i))", "3"},
+		{"(try* (throw 1) (catch* e e))", "1"},
+		{"(undefined-symbol)", "error: 'undefined-symbol' not found"},
+	})
+}
+
+func TestTypedCatches(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{`(try* (throw "x") (catch* integer e [:int e]) (catch* string e [:str e]))`, `[:str "x"]`},
+		{`(try* (throw 1) (catch* integer e [:int e]) (catch* string e [:str e]))`, `[:int 1]`},
+		{`(try* (throw 1) (catch* string e [:str e]) (catch* e [:any e]))`, `[:any 1]`},
+		{`(try* (throw (ex-info "x" {})) (catch* ExInfo e (ex-message e)))`, `"x"`},
+		{`(try* (throw 1) (catch* MalError e e))`, `1`},
+		{`(try* (undefined-symbol) (catch* MalError e :thrown) (catch* e :other))`, `:other`},
+		{`(try* (throw 1) (catch* string e e))`, `error: 1`},
+		{`(try* (try* (throw 1) (catch* string e e)) (catch* e [:outer e]))`, `[:outer 1]`},
+		{`(try* 1)`, `1`},
+		{`(try*)`, `error: Invalid try* form`},
+		{`(try* (throw 1) (catch* e))`, `error: Invalid try* form`},
+		{`(try* (throw 1) (finally* e))`, `error: Invalid try* form`},
+	})
+}
+
+func TestBuiltinFnsHaveIDs(t *testing.T) {
+	env := NewInterpreter(Limits{}).Env
+	itr := env.Bindings.Iterator()
+	for !itr.Done() {
+		name, value := itr.Next()
+		if fn, valid := value.(types.Function); valid && fn.ID == 0 {
+			t.Errorf("%v has no id", name)
+		}
+	}
+}
+
+func TestCond(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(cond true 1 false 2)", "1"},
+		{"(cond false 1 true 2)", "2"},
+		{"(cond false 1 :else 3)", "3"},
+		{"(cond nil 1 :else 3)", "3"},
+		{"(cond false 1)", "nil"},
+		{"(cond)", "nil"},
+		{"(def! x 5) (cond (< x 0) :neg (= x 0) :zero :else :pos)", ":pos"},
+		{"(cond false 1 3)", `error: "cond requires an even number of forms"`},
+		{"(cond 3)", `error: "cond requires an even number of forms"`},
+	})
+}
+
+func TestAtomMetadata(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(meta (atom 1))", "nil"},
+		{"(def! a (atom 1)) (reset-meta! a {:x 1}) (meta a)", "{:x 1}"},
+		{"(def! a (atom 1)) (reset-meta! a {:x 1}) (alter-meta! a assoc :y 2) (meta a)", "{:x 1 :y 2}"},
+		{"(def! a (atom 1)) (alter-meta! a assoc :y 2)", "{:y 2}"},
+		{"(def! a (atom 1)) (reset-meta! a {:x 1}) (reset! a 2) [@a (meta a)]", "[2 {:x 1}]"},
+		{"(def! a (atom 1)) (reset-meta! a nil) (meta a)", "nil"},
+		{"(reset-meta! (atom 1) 1)", "error: reset-meta! requires map or nil metadata"},
+		{"(reset-meta! [] {})", "error: reset-meta! requires an atom value"},
+		{"(with-meta (atom 1) {:x 1})", "error: with-meta can't copy an atom; use reset-meta! or alter-meta! to change its metadata"},
+		{"(meta (with-meta [1] {:x 1}))", "{:x 1}"},
+		{"(with-meta [1])", "error: with-meta requires 2 args"},
+	})
+}
+
+func TestReadBigints(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{`(read-string "9223372036854775808")`, `error: reader error at 1:1: Unparseable integer: strconv.ParseInt: parsing "9223372036854775808": value out of range`},
+		{`(def! *read-bigints* true) (read-string "9223372036854775808")`, "9223372036854775808"},
+		{`(def! *read-bigints* true) (type (read-string "9223372036854775808"))`, ":bigint"},
+		{`(def! *read-bigints* true) (- (read-string "9223372036854775808") 1)`, "9223372036854775807"},
+		{`(def! *read-bigints* true) (type (- (read-string "9223372036854775808") 1))`, ":integer"},
+		{"(* 9223372036854775807 2)", "18446744073709551614"},
+		{"(< 9223372036854775807 (inc 9223372036854775807))", "true"},
+	})
+}
+
+func TestFnNames(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(def! foo (fn* [] 1)) (pr-str foo)", `"#<fn user/foo>"`},
+		{"(defmacro! bar (fn* [] 1)) (pr-str bar)", `"#<fn user/bar>"`},
+		{"(def! foo (fn* [] 1)) (def! baz foo) (pr-str baz)", `"#<fn user/foo>"`},
+		{"(pr-str (fn* [] 1))", `"#FN"`},
+	})
+}
+
+func TestClosuresCaptureTheirEnv(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(def! fs (map (fn* [x] (fn* [] x)) [1 2 3])) (map (fn* [f] (f)) fs)", "(1 2 3)"},
+		{"(def! adder (fn* [n] (fn* [x] (+ n x)))) (def! fs (map adder [10 20])) [((first fs) 1) ((nth fs 1) 1)]", "[11 21]"},
+		{"(def! f (let* [x 1] (fn* [] x))) (def! x 2) (f)", "1"},
+		{"(loop* [i 0 fs []] (if (< i 3) (recur (inc i) (conj fs (fn* [] i))) (map (fn* [f] (f)) fs)))", "(0 1 2)"},
+	})
+}
+
+func TestAutoGensyms(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(def! f `(x# x#)) (= (first f) (nth f 1))", "true"},
+		{"(def! f `(x# y#)) (= (first f) (nth f 1))", "false"},
+		{"(= `x# `x#)", "false"},
+		{"(symbol? `x#)", "true"},
+		{"(namespace `x#)", "nil"},
+		{"`(foo ~'x)", "(foo x)"},
+		{"(defmacro! twice (fn* [x] `(let* [v# ~x] (+ v# v#)))) (let* [v 2] (twice v))", "4"},
+	})
+}
+
+func TestPrintVars(t *testing.T) {
+	wide := "(def! v [[1 [2 [3 [4]]] 5 6] (range) {:a [1 2 3]} [7 8 9] 10])"
+	evalTests(t, []struct{ input, expected string }{
+		{wide + " (pr-str v)", `"[[1 [2 [3 [4]]] 5 6] (0 1 2 3 4 5 6 7 8 9 ...) {:a [1 2 3]} [7 8 9] 10]"`},
+		{wide + " (def! *print-length* 2) (pr-str v)", `"[[1 [2 [3 [4]]] ...] (0 1 ...) ...]"`},
+		{wide + " (def! *print-level* 2) (pr-str v)", `"[[1 # 5 6] (0 1 2 3 4 5 6 7 8 9 ...) {:a #} [7 8 9] 10]"`},
+		{wide + " (def! *print-length* 2) (def! *print-level* 2) (pr-str v)", `"[[1 # ...] (0 1 ...) ...]"`},
+		{"(def! *print-readably* false) (pr-str \"a\")", `"a"`},
+		{"(let* [*print-length* 2] (pr-str [1 2 3 4]))", `"[1 2 3 4]"`},
+	})
+}
+
+func TestInputBuffer(t *testing.T) {
+	tests := []struct {
+		lines    []string
+		expected string
+	}{
+		{[]string{"(+ 1 2)"}, "(+ 1 2)"},
+		{[]string{"(+ 1", "2)"}, "(+ 1\n2)"},
+		{[]string{"(let* [x 1", "y 2]", "(+ x y))"}, "(let* [x 1\ny 2]\n(+ x y))"},
+		{[]string{"(+ 1 ; one", "2)"}, "(+ 1 ; one\n2)"},
+		{[]string{`(str "a`, `b")`}, "(str \"a\nb\")"},
+		{[]string{`"a`, `b"`}, "\"a\nb\""},
+		{[]string{"1)"}, "1)"},
+		{[]string{""}, ""},
+		{[]string{"; comment"}, "; comment"},
+		{[]string{"(foo :a:"}, "(foo :a:"},
+	}
+	for _, test := range tests {
+		var input inputBuffer
+		var text string
+		var complete bool
+		for i, line := range test.lines {
+			if complete {
+				t.Errorf("%q: complete before line %d", test.lines, i)
+			}
+			text, complete = input.add(line)
+		}
+		if !complete {
+			t.Errorf("%q: incomplete", test.lines)
+		}
+		if text != test.expected {
+			t.Errorf("%q: buffered %q, not %q", test.lines, text, test.expected)
+		}
+		if input.pending() {
+			t.Errorf("%q: pending after completing", test.lines)
+		}
+	}
+}
+
+func TestInputBufferReset(t *testing.T) {
+	var input inputBuffer
+	if _, complete := input.add("(+ 1"); complete {
+		t.Fatal("unbalanced input completed")
+	}
+	if !input.pending() {
+		t.Fatal("unbalanced input not pending")
+	}
+	input.reset()
+	if input.pending() {
+		t.Fatal("reset input pending")
+	}
+	if text, complete := input.add("2"); !complete || text != "2" {
+		t.Errorf("input after reset buffered %q", text)
+	}
+}
+
+func TestHistoryPath(t *testing.T) {
+	env := func(vars map[string]string) func(string) string {
+		return func(name string) string { return vars[name] }
+	}
+	home := func(dir string, err error) func() (string, error) {
+		return func() (string, error) { return dir, err }
+	}
+	tests := []struct {
+		getenv   func(string) string
+		home     func() (string, error)
+		expected string
+	}{
+		{env(map[string]string{"GLIMPSE_HISTORY": "/tmp/h"}), home("/home/me", nil), "/tmp/h"},
+		{env(nil), home("/home/me", nil), "/home/me/.glimpse_history"},
+		{env(map[string]string{"GLIMPSE_HISTORY": ""}), home("/home/me", nil), "/home/me/.glimpse_history"},
+		{env(nil), home("", errors.New("no home")), filepath.Join(os.TempDir(), ".glimpse_history")},
+		{env(nil), home("", nil), filepath.Join(os.TempDir(), ".glimpse_history")},
+	}
+	for i, test := range tests {
+		if actual := historyPath(test.getenv, test.home); actual != test.expected {
+			t.Errorf("%d: history path %s, not %s", i, actual, test.expected)
+		}
+	}
+}
+
+func TestAppendHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glimpse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "nested", "history")
+	for _, entry := range []string{"(+ 1 2)", "(def! x 1)"} {
+		if err := appendHistory(path, entry); err != nil {
+			t.Fatal(err)
+		}
+	}
+	contents, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(contents) != "(+ 1 2)\n(def! x 1)\n" {
+		t.Errorf("history file contains %q", contents)
+	}
+}
+
+func TestParseArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected invocation
+	}{
+		{nil, invocation{mode: modeRepl}},
+		{[]string{"-e", "(+ 1 2)"}, invocation{mode: modeEval, source: "(+ 1 2)"}},
+		{[]string{"-e", "(+ 1 2)", "a", "b"}, invocation{mode: modeEval, source: "(+ 1 2)", argv: []string{"a", "b"}}},
+		{[]string{"-e", ""}, invocation{mode: modeEval}},
+		{[]string{"-"}, invocation{mode: modeStdin}},
+		{[]string{"-", "a"}, invocation{mode: modeStdin, argv: []string{"a"}}},
+		{[]string{"foo.mal"}, invocation{mode: modeFile, source: "foo.mal"}},
+		{[]string{"foo.mal", "-e", "a"}, invocation{mode: modeFile, source: "foo.mal", argv: []string{"-e", "a"}}},
+		{[]string{"--", "-e"}, invocation{mode: modeFile, source: "-e"}},
+	}
+	for _, test := range tests {
+		actual, err := parseArgs(test.args)
+		if err != nil {
+			t.Errorf("%q: %v", test.args, err)
+			continue
+		}
+		if len(actual.argv) == 0 && len(test.expected.argv) == 0 {
+			actual.argv, test.expected.argv = nil, nil
+		}
+		if !reflect.DeepEqual(actual, test.expected) {
+			t.Errorf("%q: parsed %+v, not %+v", test.args, actual, test.expected)
+		}
+	}
+	for _, args := range [][]string{{"-x"}, {"-e"}} {
+		if _, err := parseArgs(args); err == nil {
+			t.Errorf("%q: parsed", args)
+		}
+	}
+}
+
+func TestPrintError(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{`(throw "x")`, "error: \"x\"\n"},
+		{`(throw {:a 1})`, "error: {:a 1}\n"},
+		{`(nope)`, "error: 'nope' not found\n"},
+	}
+	for _, test := range tests {
+		_, err := eval(NewInterpreter(Limits{}), test.input)
+		var sb strings.Builder
+		printError(&sb, err)
+		if sb.String() != test.expected {
+			t.Errorf("%s: printed %q, not %q", test.input, sb.String(), test.expected)
+		}
+	}
+}
+
+func TestFor(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(for [x [1 2 3]] (* x x))", "(1 4 9)"},
+		{"(for [x []] x)", "()"},
+		{"(for [x (range 6) :when (> x 2)] (* x x))", "(9 16 25)"},
+		{"(for [x [1 2 3] :let [y (* x 10)]] (+ x y))", "(11 22 33)"},
+		{"(for [x [1 2] y [:a :b]] [x y])", "([1 :a] [1 :b] [2 :a] [2 :b])"},
+		{"(for [x [1 2 3] y [1 2 3] :when (< x y)] [x y])", "([1 2] [1 3] [2 3])"},
+		{"(for [x [1 2] :let [y (inc x)] z [x y]] z)", "(1 2 2 3)"},
+		{"(for [[k v] {:a 1}] [v k])", "([1 :a])"},
+		{"(def! a (atom [])) (doseq [x [1 2] y [3 4]] (swap! a conj (* x y))) @a", "[3 4 6 8]"},
+		{"(doseq [x [1 2]] x)", "nil"},
+		{"(take 3 (for [x (range)] x))", "error: map requires a finite seq"},
+		{"(for [x [1 2] y (range)] y)", "error: map requires a finite seq"},
+		{"(for [x] x)", "error: for requires an even number of binding forms"},
+		{"(for (x [1]) x)", "error: for requires a vector of bindings"},
+		{"(for [1 [1]] 1)", "error: for binding requires a symbol, vector, or map"},
+	})
+}
+
+func TestDeref(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(def! a (atom 1)) @a", "1"},
+		{"(def! a (atom 1)) (reset! a 2) (deref a)", "2"},
+		{"(def! p (promise)) (deliver p 2) @p", "2"},
+		{"(def! p (promise)) (deliver p 1) [(deliver p 2) @p]", "[nil 1]"},
+		{"(def! p (promise)) [(realized? p) (do (deliver p 1) (realized? p))]", "[false true]"},
+		{"(deref (promise) 10 :timeout)", ":timeout"},
+		{"(def! p (promise)) (deliver p 1) (deref p 10 :timeout)", "1"},
+		{"(def! d (delay (+ 1 2))) [(realized? d) @d (realized? d)]", "[false 3 true]"},
+		{"@(future (+ 1 2))", "3"},
+		{"(future? (future 1))", "true"},
+		{"(def! p (promise)) (def! f (future (inc @p))) [(realized? f) (deref f 10 :timeout) (do (deliver p 1) @f) (realized? f)]", "[false :timeout 2 true]"},
+		{`@(future (throw "x"))`, `error: "x"`},
+		{"(def! a (atom 0)) (def! fs (map (fn* [_] (future (dotimes [i 100] (swap! a inc)))) (range 10))) (doseq [f fs] @f) @a", "1000"},
+		{"(def! v (volatile! 1)) [(vswap! v + 2 3) (vreset! v 0) @v (volatile? v) (volatile? 1)]", "[6 0 0 true false]"},
+		{"(deref (volatile! 1) 10 :timeout)", "1"},
+		{"@1", "error: deref requires a derefable value"},
+		{"(deref (promise) :soon :timeout)", "error: deref requires an integer timeout in milliseconds"},
+		{"(deref (promise) 10)", "error: deref requires 1 or 3 args"},
+		{"(realized? (atom 1))", "error: realized? requires a delay, promise, or future"},
+		{"(vreset! (atom 1) 2)", "error: vreset! requires a volatile"},
+		{"(vswap! (volatile! 1) 2)", "error: vswap! requires a fn value"},
+	})
+}
+
+func TestDerefHonorsContext(t *testing.T) {
+	deadline, cancelDeadline := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelDeadline()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		input    string
+		expected error
+	}{
+		{"undelivered promise", deadline, "@(promise)", context.DeadlineExceeded},
+		{"cancelled promise", cancelled, "@(promise)", context.Canceled},
+		{"unfinished future", deadline, "(def! p (promise)) @(future (deref p 1000 nil))", context.DeadlineExceeded},
+	}
+	for _, test := range tests {
+		_, err := evalContext(test.ctx, NewInterpreter(Limits{}), test.input)
+		if err != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func TestLimits(t *testing.T) {
+	const countdown = "(def! f (fn* [n] (if (= n 0) 0 (+ 1 (f (- n 1))))))"
+	tests := []struct {
+		name     string
+		limits   Limits
+		input    string
+		expected string
+	}{
+		{"infinite loop", Limits{MaxSteps: 10000}, "(loop* [] (recur))", "error: " + PRINT(ErrStepLimit)},
+		{"infinite recursion", Limits{MaxDepth: 1000}, "(def! f (fn* [] (inc (f)))) (f)", "error: " + PRINT(ErrDepthLimit)},
+		{"deep recursion", Limits{MaxDepth: 1000}, countdown + " (f 100000)", "error: " + PRINT(ErrDepthLimit)},
+		{"steps within budget", Limits{MaxSteps: 100000}, "(loop* [i 0] (if (< i 1000) (recur (inc i)) i))", "1000"},
+		{"depth within budget", Limits{MaxDepth: 1000}, countdown + " (f 50)", "50"},
+		{"both within budget", Limits{MaxSteps: 100000, MaxDepth: 1000}, countdown + " (f 50)", "50"},
+		{"unlimited", Limits{}, "(loop* [i 0] (if (< i 100000) (recur (inc i)) i))", "100000"},
+	}
+	for _, test := range tests {
+		value, err := eval(NewInterpreter(test.limits), test.input)
+		var actual string
+		if err != nil {
+			actual = "error: " + PRINT(err)
+		} else {
+			actual = PRINT(value)
+		}
+		if actual != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestStepsAreBudgetedPerForm(t *testing.T) {
+	interp := NewInterpreter(Limits{MaxSteps: 10000})
+	for i := 0; i < 3; i++ {
+		value, err := eval(interp, "(loop* [i 0] (if (< i 500) (recur (inc i)) i))")
+		if err != nil || !reflect.DeepEqual(value, types.Integer(500)) {
+			t.Errorf("run %d: expected 500, got %v, %v", i, value, err)
+		}
+	}
+	if _, err := eval(interp, "(loop* [] (recur))"); err != ErrStepLimit {
+		t.Errorf("expected the step limit, got %v", err)
+	}
+	if value, err := eval(interp, "(+ 1 2)"); err != nil || !reflect.DeepEqual(value, types.Integer(3)) {
+		t.Errorf("expected 3 after the limit, got %v, %v", value, err)
+	}
+}
+
+func TestEvalHonorsContext(t *testing.T) {
+	deadline, cancelDeadline := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancelDeadline()
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	tests := []struct {
+		name     string
+		ctx      context.Context
+		limits   Limits
+		expected error
+	}{
+		{"deadline", deadline, Limits{}, context.DeadlineExceeded},
+		{"cancelled", cancelled, Limits{}, context.Canceled},
+		{"timeout", context.Background(), Limits{Timeout: 10 * time.Millisecond}, context.DeadlineExceeded},
+	}
+	for _, test := range tests {
+		_, err := evalContext(test.ctx, NewInterpreter(test.limits), "(loop* [] (recur))")
+		if err != test.expected {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, err)
+		}
+	}
+}
+
+func TestInterpretersAreIndependent(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	looping := NewInterpreter(Limits{})
+	errs := make(chan error)
+	go func() {
+		_, err := evalContext(ctx, looping, "(loop* [] (recur))")
+		errs <- err
+	}()
+	value, err := eval(NewInterpreter(Limits{MaxSteps: 100000}), "(loop* [i 0] (if (< i 1000) (recur (inc i)) i))")
+	if err != nil || !reflect.DeepEqual(value, types.Integer(1000)) {
+		t.Errorf("expected 1000, got %v, %v", value, err)
+	}
+	cancel()
+	if err := <-errs; err != context.Canceled {
+		t.Errorf("expected the loop to be cancelled, got %v", err)
+	}
+}
+
+func TestProgress(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []int
+	}{
+		{"(reduce + 0 (range 30000))", []int{10000, 20000, 30000}},
+		{"(reduce + (range 30000))", []int{10000, 20000}},
+		{"(count (map inc (range 25000)))", []int{10000, 20000}},
+		{"(first (mapcat list (range 20000)))", []int{10000, 20000}},
+		{"(count (into [] (range 10000)))", []int{10000}},
+		{"(count (sort (range 10000)))", []int{10000}},
+		{"(reduce + (range 9999))", nil},
+	}
+	for _, test := range tests {
+		interp := NewInterpreter(Limits{})
+		var counts []int
+		interp.Progress = func(count int) { counts = append(counts, count) }
+		if _, err := eval(interp, test.input); err != nil {
+			t.Errorf("%s: %v", test.input, err)
+		}
+		if !reflect.DeepEqual(counts, test.expected) {
+			t.Errorf("%s: expected progress at %v, got %v", test.input, test.expected, counts)
+		}
+	}
+}
+
+func TestProgressIsPerInterpreter(t *testing.T) {
+	reporting, quiet := NewInterpreter(Limits{}), NewInterpreter(Limits{})
+	var calls int
+	reporting.Progress = func(int) { calls++ }
+	if _, err := eval(quiet, "(reduce + 0 (range 20000))"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 0 {
+		t.Errorf("expected no progress from another interpreter, got %d calls", calls)
+	}
+	if _, err := eval(reporting, "(reduce + 0 (range 20000))"); err != nil {
+		t.Fatal(err)
+	}
+	if calls != 2 {
+		t.Errorf("expected 2 calls, got %d", calls)
+	}
+}
+
+func TestLoadFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "glimpse")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "lib.mal")
+	if err := ioutil.WriteFile(path, []byte("(def! x 1)\n; trailing comment"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	evalTests(t, []struct{ input, expected string }{
+		{"(load-file " + strconv.Quote(path) + ") x", "1"},
+		{"(load-file " + strconv.Quote(path) + ")", "nil"},
+		{`(load-file "-")`, `error: "load-file requires a file path: -"`},
+		{`(load-file "https://example.com/lib.mal")`, `error: "load-file requires a file path: https://example.com/lib.mal"`},
+	})
+}
+
+// defProgram defines and calls many fns, exercising special form dispatch
+var defProgram = func() string {
+	var sb strings.Builder
+	for i := 0; i < 100; i++ {
+		sb.WriteString("(def! f (fn* [x] (let* [y (inc x)] (if (> y 0) y (- y)))))\n")
+		sb.WriteString("(def! v (f 1))\n")
+	}
+	return sb.String()
+}()
+
+func BenchmarkEvalDefs(b *testing.B) {
+	interp := NewInterpreter(Limits{})
+	form, err := READ(interp.Env, "(do "+defProgram+")")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := interp.Eval(context.Background(), form); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestTakeAndDrop(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(drop 2 [1 2 3 4])", "(3 4)"},
+		{"(drop 0 [1 2])", "(1 2)"},
+		{"(drop 5 [1 2])", "()"},
+		{"(drop 1 [])", "()"},
+		{"(take 3 (drop 5 (range)))", "(5 6 7)"},
+		{"(drop -1 [1 2])", "error: drop requires a non-negative count"},
+		{"(drop :a [1 2])", "error: drop requires an integer count"},
+		{"(drop 1)", "error: drop requires 2 args"},
+		{"(def! coll [1 2 3 4 5]) (map (fn* [n] (= coll (concat (take n coll) (drop n coll)))) [0 1 2 4 5 6])", "(true true true true true true)"},
+		{"(def! coll (range 10)) (= coll (concat (take 3 coll) (drop 3 coll)))", "true"},
+	})
+}
+
+func TestSortIsStable(t *testing.T) {
+	// Enough pairs that an unstable sort would reorder equal keys
+	var pairs, sorted []string
+	for i := 0; i < 30; i++ {
+		pairs = append(pairs, fmt.Sprintf("[%d %d]", i%3, i))
+	}
+	for k := 0; k < 3; k++ {
+		for i := k; i < 30; i += 3 {
+			sorted = append(sorted, fmt.Sprintf("[%d %d]", k, i))
+		}
+	}
+	coll := "[" + strings.Join(pairs, " ") + "]"
+	ascending := "(" + strings.Join(sorted, " ") + ")"
+	evalTests(t, []struct{ input, expected string }{
+		{"(sort-by first " + coll + ")", ascending},
+		{"(sort (fn* [a b] (- (first a) (first b))) " + coll + ")", ascending},
+		{"(sort (fn* [a b] (< (first a) (first b))) " + coll + ")", ascending},
+		{"(sort-by first (fn* [a b] (< a b)) " + coll + ")", ascending},
+		{"(sort-by count [[1 2] [3] [4 5] [6] []])", "([] [3] [6] [1 2] [4 5])"},
+		{"(sort [3 1 2])", "(1 2 3)"},
+		{"(sort-by (fn* [m] (get m :k)) [{:k 1 :v :a} {:k 0 :v :b} {:k 1 :v :c} {:k 0 :v :d}])", "({:k 0 :v :b} {:k 0 :v :d} {:k 1 :v :a} {:k 1 :v :c})"},
+	})
+}
+
+func TestTakeWhileAndDropWhile(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(take-while (fn* [x] (< x 3)) [1 2 3 1])", "(1 2)"},
+		{"(take-while (fn* [x] (< x 3)) (range))", "(0 1 2)"},
+		{"(take 2 (take-while (fn* [x] (< x 5)) (range)))", "(0 1)"},
+		{"(take-while (fn* [x] true) [1 2 3])", "(1 2 3)"},
+		{"(take-while (fn* [x] false) [1 2 3])", "()"},
+		{"(take-while (fn* [x] nil) (range))", "()"},
+		{"(take-while (fn* [x] true) [])", "()"},
+		{"(drop-while (fn* [x] (< x 3)) [1 2 3 1])", "(3 1)"},
+		{"(take 3 (drop-while (fn* [x] (< x 3)) (range)))", "(3 4 5)"},
+		{"(drop-while (fn* [x] true) [1 2 3])", "()"},
+		{"(drop-while (fn* [x] false) [1 2 3])", "(1 2 3)"},
+		{"(drop-while (fn* [x] true) [])", "()"},
+		{`(take-while (fn* [x] (throw "stop")) [1])`, `error: "stop"`},
+		{"(take-while 1 [1])", "error: take-while requires a fn value"},
+		{"(drop-while (fn* [x] x))", "error: drop-while requires 2 args"},
+	})
+}
+
+// caseForm builds a case over n integer and n keyword constants, each
+// returning its own index, with a default of :none
+func caseForm(expr string, n int) string {
+	var sb strings.Builder
+	sb.WriteString("(case " + expr)
+	for i := 0; i < n; i++ {
+		fmt.Fprintf(&sb, " %d %d :k%d %d", i, i, i, -i)
+	}
+	sb.WriteString(" :none)")
+	return sb.String()
+}
+
+func TestCase(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(case 2 1 :one 2 :two :other)", ":two"},
+		{"(case 3 1 :one 2 :two :other)", ":other"},
+		{"(case 3 1 :one 2 :two)", "error: No matching case clause: 3"},
+		{"(case :b :a 1 :b 2)", "2"},
+		{`(case "x" "x" 1 "y" 2)`, "1"},
+		{"(case 2 (1 2 3) :small (4 5) :large)", ":small"},
+		{"(case 'foo foo 1 bar 2)", "1"},
+		{"(case [1 2] [1 2] :pair :other)", ":pair"},
+		{"(def! n (atom 0)) (case (swap! n inc) 1 :once 2 :twice) @n", "1"},
+		{"(case 1 1 :a 1 :b)", "error: case has a duplicate test constant"},
+		{"(case)", "error: case requires an expression"},
+		{caseForm("37", 50), "37"},
+		{caseForm(":k37", 50), "-37"},
+		{caseForm("37", 500), "37"},
+		{caseForm(":k37", 500), "-37"},
+		{caseForm("0", 1), "0"},
+		{caseForm("499", 500), "499"},
+		{caseForm("500", 500), ":none"},
+		{caseForm(":k500", 500), ":none"},
+	})
+}
+
+func TestSwap(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(def! a (atom 1)) (swap! a inc)", "2"},
+		{"(def! a (atom 1)) (swap! a + 2 3) @a", "6"},
+		{"(def! a (atom 1)) (reset! a 5) (swap! a inc)", "6"},
+		{"(def! a (atom [])) (swap! a conj 1) (swap! a conj 2)", "[1 2]"},
+		{"(def! a (atom 1)) (swap! a (fn* [x] (+ x @a)))", "2"},
+		{`(def! a (atom 1)) (try* (swap! a (fn* [x] (throw "no"))) (catch* e @a))`, "1"},
+		{"(swap!)", "error: swap! requires at least 2 args"},
+		{"(swap! (atom 1))", "error: swap! requires at least 2 args"},
+		{"(swap! (atom 1) 2)", "error: swap! requires a fn value"},
+		{"(swap! 1 inc)", "error: swap! requires an atom value"},
+		{"(swap! (atom 1) when)", "error: can't take value of a macro"},
+	})
+}
+
+func TestVaryMeta(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(def! f (fn* [x] (* x 2))) (def! g (vary-meta f assoc :doc \"doubles\")) [(g 3) (meta g)]", `[6 {:doc "doubles"}]`},
+		{"(def! f (fn* [x] (* x 2))) (def! g (vary-meta f assoc :a 1)) [(f 3) (meta f)]", "[6 nil]"},
+		{"(def! f (fn* [& xs] (count xs))) ((vary-meta f assoc :a 1) 1 2 3)", "3"},
+		{"(def! f (fn* [n] (if (= n 0) :done (f (- n 1))))) ((vary-meta f assoc :a 1) 5)", ":done"},
+		{"(def! f (with-meta (fn* [] 1) {:a 1})) (meta (vary-meta f update :a inc))", "{:a 2}"},
+		{"((vary-meta + assoc :a 1) 1 2)", "3"},
+		{"(def! s (vary-meta 'foo assoc :tag :x)) [s (meta s) (= s 'foo)]", "[foo {:tag :x} true]"},
+		{"(meta (vary-meta [1] assoc :a 1))", "{:a 1}"},
+		{"(vary-meta [1] (fn* [m] 1))", `error: #error {:code "Invalid type"}`},
+		{"(vary-meta 1 assoc :a 1)", `error: #error {:code "Invalid type"}`},
+		{"(vary-meta (atom 1) assoc :a 1)", "error: vary-meta can't copy an atom; use alter-meta! to change its metadata"},
+		{"(vary-meta [1])", "error: vary-meta requires at least 2 args"},
+	})
+}
+
+func TestMacroexpandAll(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(macroexpand-all (when true (when-not false 1)))", "(if true (do (if false nil (do 1))))"},
+		{"(macroexpand-all (+ 1 (when x 2)))", "(+ 1 (if x (do 2)))"},
+		{"(macroexpand-all [(when a 1) {:k (when b 2)}])", "[(if a (do 1)) {:k (if b (do 2))}]"},
+		{"(macroexpand-all (quote (when a 1)))", "'(when a 1)"},
+		{"(macroexpand-all (let* [x (when a 1)] (when x x)))", "(let* [x (if a (do 1))] (if x (do x)))"},
+		{"(macroexpand-all 1)", "1"},
+		{"(macroexpand (+ 1 (when x 2)))", "(+ 1 (when x 2))"},
+		{"(defmacro! m (fn* [n] (if (= n 0) :done (list 'm (- n 1))))) (macroexpand-all (m 5))", ":done"},
+		{"(defmacro! nest (fn* [n] (if (= n 0) 0 (list 'inc (list 'nest (- n 1)))))) (macroexpand-all (nest 3))", "(inc (inc (inc 0)))"},
+		{"(defmacro! nest (fn* [n] (if (= n 0) 0 (list 'inc (list 'nest (- n 1)))))) (eval (macroexpand-all (nest 3)))", "3"},
+		{"(defmacro! forever (fn* [] (list 'inc (list 'forever)))) (macroexpand-all (forever))", "error: macroexpand-all exceeded the maximum depth"},
+		{"(macroexpand-all)", "error: macroexpand-all requires 1 arg"},
+	})
+}
+
+func TestSwapVals(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(def! a (atom 1)) (swap-vals! a inc)", "[1 2]"},
+		{"(def! a (atom 1)) (swap-vals! a + 2 3) @a", "6"},
+		{"(def! a (atom [])) (swap-vals! a conj :x)", "[[] [:x]]"},
+		{"(def! a (atom 1)) (def! v (swap-vals! a inc)) (= (nth v 1) @a)", "true"},
+		{"(swap-vals! (atom 1))", "error: swap-vals! requires at least 2 args"},
+		{"(swap-vals! (atom 1) 2)", "error: swap-vals! requires a fn value"},
+		{"(swap-vals! 1 inc)", "error: swap-vals! requires an atom value"},
+	})
+}
+
+func TestParseIntErrorsAreCatchable(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{`(try* (parse-int "x") (catch* e :bad))`, ":bad"},
+		{`(try* (parse-int "12") (catch* e :bad))`, "12"},
+	})
+}
+
+func TestReadEvalVar(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{`(read-string "#=(+ 1 2)")`, "error: reader error at 1:1: Unsupported #= form: read-eval is disabled"},
+		{`(def! *read-eval* true) (read-string "#=(+ 1 2)")`, "(eval (+ 1 2))"},
+		{`(def! *read-eval* true) (eval (read-string "[#=(+ 1 2) #=x]")) `, "error: 'x' not found"},
+		{`(def! *read-eval* true) (def! x 4) (eval (read-string "[#=(+ 1 2) #=x]"))`, "[3 4]"},
+		{`(def! *read-eval* nil) (read-string "#=x")`, "error: reader error at 1:1: Unsupported #= form: read-eval is disabled"},
+	})
+}
+
+func TestLetfn(t *testing.T) {
+	evalTests(t, []struct {
+		input    string
+		expected string
+	}{
+		{"(letfn* [ev? (fn* [n] (if (= n 0) true (od? (- n 1)))) od? (fn* [n] (if (= n 0) false (ev? (- n 1))))] [(ev? 10) (od? 7) (ev? 7)])", "[true true false]"},
+		{"(letfn* [] 1)", "1"},
+		{"(letfn* [f (fn* [] 1)])", "error: letfn* requires 2 args"},
+		{"(letfn* f 1)", "error: letfn* requires a binding sequential arg"},
+		{"(letfn* [f] 1)", "error: letfn* requires an even list of bindings"},
+		{"(letfn* [\"f\" (fn* [] 1)] 1)", "error: letfn* binding arg requires a symbol"},
+		{"(letfn* [f 1] 1)", "error: letfn* binding value requires a fn"},
+	})
+}
+
+func TestLoopRecur(t *testing.T) {
+	evalTests(t, []struct {
+		input    string
+		expected string
+	}{
+		{"(loop* [i 0 sum 0] (if (= i 100000) sum (recur (+ i 1) (+ sum i))))", "4999950000"},
+		{"(loop* [xs [1 2 3] acc ()] (if (empty? xs) acc (recur (rest xs) (cons (first xs) acc))))", "(3 2 1)"},
+		{"(loop* [a 1 b (+ a 1)] [a b])", "[1 2]"},
+		{"(loop* [i 0] (if (= i 3) i (do (recur (+ i 1)))))", "3"},
+		{"(loop* [i 0] (+ 1 (recur i)))", "error: recur requires tail position within loop*"},
+		{"(recur 1)", "error: recur requires tail position within loop*"},
+		{"(loop* [i 0] (recur))", "error: recur requires 1 args"},
+		{"(loop* [i] i)", "error: loop* requires an even list of bindings"},
+		{"(loop* [1 0] 1)", "error: loop* binding arg requires a symbol"},
+		{"(loop* i 1)", "error: loop* requires a binding sequential arg"},
+		{"(loop* [])", "error: loop* requires 2 args"},
+	})
+}
+
+func TestDeepMacroExpansion(t *testing.T) {
+	evalTests(t, []struct {
+		input    string
+		expected string
+	}{
+		{"(defmacro! down (fn* [n] (if (= n 0) :done (list 'down (- n 1))))) (down 10000)", ":done"},
+		{"(defmacro! down (fn* [n] (if (= n 0) :done (list 'down (- n 1))))) (macroexpand (down 10000))", ":done"},
+		{"(def! sum* (fn* [n acc] (if (= n 0) acc (sum* (- n 1) (+ acc n))))) (defmacro! sum (fn* [n] (sum* n 0))) (sum 10000)", "50005000"},
+		{"(defmacro! unless (fn* [c & body] (list 'if c nil (cons 'do body)))) (unless false 1 2)", "2"},
+		{"(defmacro! bad (fn* [] (throw \"no\"))) (bad)", `error: "no"`},
+	})
+}
+
+func TestDestructuring(t *testing.T) {
+	evalTests(t, []struct {
+		input    string
+		expected string
+	}{
+		{"(let* [[a b] [1 2 3]] [a b])", "[1 2]"},
+		{"(let* [[a b c] '(1 2)] [a b c])", "[1 2 nil]"},
+		{"(let* [[a & more] [1 2 3]] [a more])", "[1 (2 3)]"},
+		{"(let* [[a & more] [1]] [a more])", "[1 ()]"},
+		{"(let* [[a [b c] & [d & e]] [1 [2 3] 4 5 6]] [a b c d e])", "[1 2 3 4 (5 6)]"},
+		{"(let* [[a :as all] [1 2]] [a all])", "[1 [1 2]]"},
+		{"(let* [[a b] nil] [a b])", "[nil nil]"},
+		{"(let* [[a b] (range)] [a b])", "[0 1]"},
+		{"(let* [{a :a b :b} {:a 1 :b 2}] [a b])", "[1 2]"},
+		{"(let* [{a :a} {}] a)", "nil"},
+		{"(let* [{:keys [x y] :as m} {:x 1 :y 2}] [x y m])", "[1 2 {:x 1 :y 2}]"},
+		{"(let* [{[a b] :pair} {:pair [1 2]}] [a b])", "[1 2]"},
+		{"(let* [[{a :a} & rest] [{:a 1} 2 3]] [a rest])", "[1 (2 3)]"},
+		{"((fn* [[a b] {c :c}] [a b c]) [1 2] {:c 3})", "[1 2 3]"},
+		{"((fn* [a & [b c]] [a b c]) 1 2 3)", "[1 2 3]"},
+		{"(let* [[a b] 1] a)", "error: vector binds require a seqable value"},
+		{"(let* [{a :a} 1] a)", "error: map binds require an indexed value"},
+		{"(let* [[a &] [1]] a)", "error: & requires a bind"},
+		{"(let* [[a :as] [1]] a)", "error: :as requires a bind"},
+		{"(let* [{:keys x} {}] x)", "error: :keys requires a vector of symbols"},
+		{"(let* [1 1] 1)", "error: binds must be symbols, vectors, or maps"},
+	})
+}
+
+func TestSmallMapOrder(t *testing.T) {
+	grow := func(keys string) string {
+		return "(reduce (fn* [m k] (assoc m k (inc k))) {} " + keys + ")"
+	}
+	evalTests(t, []struct {
+		input    string
+		expected string
+	}{
+		{"(keys (assoc {} :z 1 :a 2 :m 3))", "(:z :a :m)"},
+		{"(vals (assoc {} :z 1 :a 2 :m 3))", "(1 2 3)"},
+		{"(keys (assoc {:z 1 :a 2} :z 3))", "(:z :a)"},
+		{"(keys (dissoc (assoc {} :z 1 :a 2 :m 3) :a))", "(:z :m)"},
+		{"(assoc {} :z 1 :a 2 :m 3)", "{:z 1 :a 2 :m 3}"},
+		{"(keys (hash-map :c 1 :b 2 :a 3))", "(:c :b :a)"},
+		{"(keys " + grow("[7 6 5 4 3 2 1 0]") + ")", "(7 6 5 4 3 2 1 0)"},
+		{"(count " + grow("(range 20)") + ")", "20"},
+		{"(get " + grow("(range 20)") + " 13)", "14"},
+		{"(= " + grow("(range 20)") + " " + grow("[19 18 17 16 15 14 13 12 11 10 9 8 7 6 5 4 3 2 1 0]") + ")", "true"},
+		{"(= (keys " + grow("(range 20)") + ") (keys " + grow("[19 18 17 16 15 14 13 12 11 10 9 8 7 6 5 4 3 2 1 0]") + "))", "true"},
+		{"(count (reduce dissoc " + grow("(range 20)") + " (range 15)))", "5"},
+		{"(get (reduce dissoc " + grow("(range 20)") + " (range 15)) 17)", "18"},
+		{"(= {:a 1 :b 2} {:b 2 :a 1})", "true"},
+	})
+}
+
+func TestNamespacedNamesRoundTrip(t *testing.T) {
+	evalTests(t, []struct {
+		input    string
+		expected string
+	}{
+		{":foo/bar", ":foo/bar"},
+		{"'foo/bar", "foo/bar"},
+		{"(read-string (pr-str :foo/bar))", ":foo/bar"},
+		{"(= :foo/bar (read-string (pr-str :foo/bar)))", "true"},
+		{"(= 'foo/bar (read-string (pr-str 'foo/bar)))", "true"},
+		{"(namespace (read-string \"foo/bar\"))", `"foo"`},
+		{"(= :foo/bar :bar)", "false"},
+		{"(= :foo/bar (keyword \"foo/bar\"))", "true"},
+		{"(get {:foo/bar 1 :bar 2} :foo/bar)", "1"},
+	})
+}
+
+func TestNameBuildsStrings(t *testing.T) {
+	evalTests(t, []struct {
+		input    string
+		expected string
+	}{
+		{`(str "col-" (name :id))`, `"col-id"`},
+		{`(map name [:a 'b "c"])`, `("a" "b" "c")`},
+	})
+}
+
+func TestAssocInAndGetIn(t *testing.T) {
+	evalTests(t, []struct {
+		input    string
+		expected string
+	}{
+		{"(def! m {:a {:b 1}}) (assoc-in m [:a :b] 2) m", "{:a {:b 1}}"},
+		{"(get-in (assoc-in {} [:a :b :c :d] 1) [:a :b :c :d])", "1"},
+		{"(get-in (assoc-in {} [:a :b] 1) [:a :x :y] :none)", ":none"},
+		{"(assoc-in {:a 1} [:a :b] 2)", `error: #error {:code "Invalid type"}`},
+		{"(assoc-in {} [] 1)", `error: #error {:code "Invalid value"}`},
+	})
+}
+
+func TestUpdate(t *testing.T) {
+	evalTests(t, []struct {
+		input    string
+		expected string
+	}{
+		{"(update {:a 1} :a inc)", "{:a 2}"},
+		{"(update {:a 1} :a + 10 100)", "{:a 111}"},
+		{"(update {} :a (fn* [x] x))", "{:a nil}"},
+		{"(update {:a [1]} :a conj 2)", "{:a [1 2]}"},
+		{"(update-in {:a {:b 1}} [:a :b] inc)", "{:a {:b 2}}"},
+		{"(update-in {:a {:b 1}} [:a :b] - 1)", "{:a {:b 0}}"},
+		{"(update-in {} [:a :b] (fn* [x] (if (nil? x) 0 x)))", "{:a {:b 0}}"},
+		{"(def! m {:a {:b 1}}) (update-in m [:a :b] inc) m", "{:a {:b 1}}"},
+		{"(update {:a 1} :a (fn* [x] (throw {:at x})))", "error: {:at 1}"},
+		{"(update-in {:a {:b 1}} [:a :b] (fn* [x] (throw \"bad\")))", `error: "bad"`},
+		{"(update {:a \"s\"} :a inc)", "error: inc requires an integer arg"},
+		{"(update {:a 1} :a 1)", "error: update requires a fn value"},
+		{"(update-in {:a 1} [:a] :k)", "error: update-in requires a fn value"},
+		{"(update-in {:a 1} [:a :b] (fn* [x] 0))", `error: #error {:code "Invalid type"}`},
+		{"(update {:a 1} :a)", "error: update requires at least 3 args"},
+		{"(update-in {:a 1} [:a])", "error: update-in requires at least 3 args"},
+	})
+}
+
+func TestSelectKeysKeepsValues(t *testing.T) {
+	evalTests(t, []struct {
+		input    string
+		expected string
+	}{
+		{"(def! v [1 2]) (identical? v (get (select-keys {:a v :b 1} [:a]) :a))", "true"},
+		{"(def! m {:a 1}) (select-keys m [:a]) m", "{:a 1}"},
+	})
+}
+
+func TestStringBuilder(t *testing.T) {
+	many := "(range 1000)"
+	evalTests(t, []struct {
+		input    string
+		expected string
+	}{
+		{"(to-string (string-builder))", `""`},
+		{`(def! xs ["a" 1 :b nil \c [1 "d"]]) (= (to-string (apply append! (string-builder) xs)) (apply str xs))`, "true"},
+		{`(to-string (append! (string-builder) "a" 1 :b \c [1 "d"]))`, `"a1:bc[1 d]"`},
+		{"(def! sb (string-builder)) (reduce (fn* [sb x] (append! sb x \",\")) sb " + many + ") (= (to-string sb) (apply str (mapcat (fn* [x] [x \",\"]) " + many + ")))", "true"},
+		{"(def! sb (string-builder)) (append! sb \"a\") (append! sb \"b\") (to-string sb)", `"ab"`},
+		{"(def! sb (string-builder)) (append! sb \"a\") (def! s (to-string sb)) (append! sb \"b\") s", `"a"`},
+		{"(identical? (def! sb (string-builder)) (append! sb 1))", "true"},
+		{"(append!)", "error: append! requires at least 1 arg"},
+		{"(append! \"s\" 1)", "error: append! requires a string builder"},
+		{"(to-string \"s\")", "error: to-string requires a string builder"},
+		{"(string-builder 1)", "error: string-builder requires 0 args"},
+	})
+}
+
+func TestZipmapOfInfiniteSeqs(t *testing.T) {
+	evalTests(t, []struct {
+		input    string
+		expected string
+	}{
+		{"(zipmap [:a :b] (range))", "{:a 0 :b 1}"},
+		{"(zipmap (range) [:a :b])", "{0 :a 1 :b}"},
+		{"(zipmap 1 [1])", `error: #error {:code "Invalid type"}`},
+	})
+}
+
+func TestMutableArrays(t *testing.T) {
+	evalTests(t, []struct {
+		input    string
+		expected string
+	}{
+		{"(count (make-array 3))", "3"},
+		{"(seq (make-array 2))", "(nil nil)"},
+		{"(def! a (make-array 3)) (aset a 1 :x) (aget a 1)", ":x"},
+		{"(def! a (make-array 3)) (aset a 0 :x)", ":x"},
+		{"(def! a (make-array 3)) (aset a 0 1) (aset a 2 3) (seq a)", "(1 nil 3)"},
+		{"(def! a (make-array 1)) (def! s (seq a)) (aset a 0 1) s", "(nil)"},
+		{"(def! a (make-array 5)) (dotimes [i 5] (aset a i (* i i))) (reduce + a)", "30"},
+		{"(= (make-array 1) (make-array 1))", "false"},
+		{"(def! a (make-array 1)) (= a a)", "true"},
+		{"(count (make-array 0))", "0"},
+		{"(aget (make-array 0) 0)", "error: aget index out of bounds"},
+		{"(aget (make-array 3) 3)", "error: aget index out of bounds"},
+		{"(aget (make-array 3) -1)", "error: aget index out of bounds"},
+		{"(aset (make-array 3) 3 1)", "error: aset index out of bounds"},
+		{"(aget (make-array 3) :a)", "error: aget requires an integer index"},
+		{"(aget [1 2] 0)", "error: aget requires an array"},
+		{"(aset (make-array 3) 0)", "error: aset requires 3 args"},
+		{"(aget (make-array 3))", "error: aget requires 2 args"},
+		{"(make-array -1)", "error: make-array requires a non-negative integer size"},
+		{"(make-array)", "error: make-array requires 1 arg"},
+	})
+}
+
+func TestMapcat(t *testing.T) {
+	evalTests(t, []struct {
+		input    string
+		expected string
+	}{
+		{"(mapcat (fn* [x] [x x]) [1 2])", "(1 1 2 2)"},
+		{"(mapcat (fn* [x] (take x (range))) [0 1 2 3])", "(0 0 1 0 1 2)"},
+		{"(mapcat (fn* [x] []) [1 2 3])", "()"},
+		{"(mapcat (fn* [x] (if (= x 2) [] [x])) [1 2 3])", "(1 3)"},
+		{"(mapcat (fn* [x] nil) [1 2])", "()"},
+		{"(mapcat list [])", "()"},
+		{"(mapcat (fn* [x] x) [\"ab\" \"c\"])", `(\a \b \c)`},
+		{"(mapcat (fn* [x] (seq {x 1})) [:a :b])", "([:a 1] [:b 1])"},
+		{"(into [] (mapcat (fn* [x] [x (inc x)]) [1 3]))", "[1 2 3 4]"},
+		{"(mapcat (fn* [x] x) [[1] 2])", `error: #error {:code "Invalid type"}`},
+		{"(mapcat (fn* [x] (throw x)) [1])", "error: 1"},
+		{"(mapcat 1 [1])", "error: mapcat requires a fn value"},
+		{"(mapcat list)", "error: mapcat requires 2 args"},
+	})
+}
+
+func TestEveryAndSome(t *testing.T) {
+	evalTests(t, []struct {
+		input    string
+		expected string
+	}{
+		{"(every? number? [1 2 3])", "true"},
+		{"(every? number? [1 :a 3])", "false"},
+		{"(every? number? [])", "true"},
+		{"(every? number? nil)", "true"},
+		{"(every? (fn* [x] (< x 3)) (range))", "false"},
+		{"(def! seen (atom 0)) (every? (fn* [x] (do (swap! seen inc) (< x 2))) [0 1 2 3 4]) @seen", "3"},
+		{"(every? (fn* [x] (throw x)) [1])", "error: 1"},
+		{"(some (fn* [x] (if (> x 2) (* x 10))) [1 2 3 4])", "30"},
+		{"(some nil? [1 2])", "nil"},
+		{"(some nil? [])", "nil"},
+		{"(some (fn* [x] x) [nil false])", "nil"},
+		{"(some (fn* [x] (if (> x 1000) x)) (range))", "1001"},
+		{"(def! seen (atom 0)) (some (fn* [x] (do (swap! seen inc) (= x 2))) [0 1 2 3 4]) @seen", "3"},
+		{"(some (fn* [x] (throw x)) [1])", "error: 1"},
+		{"(some nil? [1] 2)", "error: some requires 2 args"},
+		{"(every? nil?)", "error: every? requires 2 args"},
+	})
+}
+
+func TestRealized(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(realized? (delay 1))", "false"},
+		{"(def! d (delay 1)) (force d) (realized? d)", "true"},
+		{"(def! n (atom 0)) (def! d (delay (swap! n inc))) (realized? d) (realized? d) [@n (force d) (force d) @n]", "[0 1 1 1]"},
+		{"(def! d (delay 1)) [(realized? d) (force d) (realized? d)]", "[false 1 true]"},
+		{"(def! d (delay (throw 1))) (try* (force d) (catch* e e)) (realized? d)", "true"},
+		{"(def! d (delay (throw 1))) (try* (force d) (catch* e e)) (force d)", "error: 1"},
+		{"(realized? (promise))", "false"},
+		{"(def! p (promise)) (deliver p nil) (realized? p)", "true"},
+		{"(force 1)", "1"},
+		{"(realized?)", "error: realized? requires 1 arg"},
+		{"(realized? 1)", "error: realized? requires a delay, promise, or future"},
+	})
+}
+
+func TestAssocNoop(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(def! m {:a 1}) (identical? m (assoc m :a 1))", "true"},
+		{"(def! m {:a [1 2]}) (identical? m (assoc m :a (list 1 2)))", "true"},
+		{"(def! m {:a 1 :b 2}) (identical? m (assoc m :a 1 :b 2))", "true"},
+		{"(def! m {:a 1}) (identical? m (assoc m :a 2))", "false"},
+		{"(def! m {:a 1}) (identical? m (assoc m :b 1))", "false"},
+		{"(def! m {:a nil}) (identical? m (assoc m :a nil))", "true"},
+		{"(def! m {:a 1}) (identical? m (assoc m))", "true"},
+		{"(def! m (reduce (fn* [m k] (assoc m k k)) {} (range 20))) (identical? m (assoc m 13 13))", "true"},
+		{"(def! m (with-meta {:a 1} {:m 1})) (meta (assoc m :a 1))", "{:m 1}"},
+		{"(def! m {:a 1}) (assoc m :a 2) m", "{:a 1}"},
+	})
+}
+
+func TestBooleanMatchesIf(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(map (fn* [x] (= (boolean x) (if x true false))) [nil false true 0 \"\" [] :a])", "(true true true true true true true)"},
+		{"[(when 0 :yes) (when nil :yes) (when-not false :yes) (when-not 0 :yes)]", "[:yes nil :yes nil]"},
+	})
+}
+
+func TestThreading(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(-> 1 inc (* 10) (- 5))", "15"},
+		{"(->> 1 inc (* 10) (- 5))", "-15"},
+		{"(-> 5)", "5"},
+		{"(-> {:a {:b 2}} (get :a) (get :b) inc)", "3"},
+		{"(-> {:a 1} (assoc :b 2) (dissoc :a))", "{:b 2}"},
+		{"(->> [1 2 3] (map inc) (reduce +))", "9"},
+		{"(->> {:a 1 :b 2} keys (map name) (join \",\"))", `"a,b"`},
+		{"(-> [1 2] (conj 3) count)", "3"},
+		{"(macroexpand (-> x f (g y)))", "(g (f x) y)"},
+		{"(macroexpand (->> x f (g y)))", "(g y (f x))"},
+		{"(->)", "error: -> requires at least 1 arg"},
+		{"(->> 1 ())", "error: ->> requires non-empty forms"},
+	})
+}
+
+func TestDotimesAndWhile(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(def! n (atom 0)) (dotimes [i 5] (swap! n inc)) @n", "5"},
+		{"(def! n (atom 0)) (dotimes [i 5] (swap! n + i)) @n", "10"},
+		{"(def! n (atom 0)) (dotimes [i 0] (swap! n inc)) @n", "0"},
+		{"(def! n (atom 0)) (dotimes [i -1] (swap! n inc)) @n", "0"},
+		{"(dotimes [i 3] i)", "nil"},
+		{"(def! calls (atom 0)) (def! n (atom 0)) (dotimes [i (do (swap! calls inc) 3)] (swap! n inc)) [@calls @n]", "[1 3]"},
+		{"(def! n (atom 0)) (dotimes [i 20000] (swap! n inc)) @n", "20000"},
+		{"(def! n (atom 0)) (while (< @n 5) (swap! n inc)) @n", "5"},
+		{"(def! n (atom 0)) (while false (swap! n inc)) @n", "0"},
+		{"(def! n (atom 10)) (def! steps (atom 0)) (while (> @n 0) (swap! n dec) (swap! steps inc)) [@n @steps]", "[0 10]"},
+		{"(def! n (atom 0)) (while (< @n 20000) (swap! n inc)) @n", "20000"},
+		{"(while false 1)", "nil"},
+	})
+}
+
+func TestAndOr(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"[(and) (and 1) (and 1 2) (and 1 nil 2) (and false nil)]", "[true 1 2 nil false]"},
+		{"[(or) (or 1) (or nil 2) (or nil false) (or false nil)]", "[nil 1 2 false nil]"},
+		{"(def! n (atom 0)) (and false (swap! n inc)) @n", "0"},
+		{"(def! n (atom 0)) (and nil (swap! n inc) (swap! n inc)) @n", "0"},
+		{"(def! n (atom 0)) (and 1 (swap! n inc) nil (swap! n inc)) @n", "1"},
+		{"(def! n (atom 0)) (or 1 (swap! n inc)) @n", "0"},
+		{"(def! n (atom 0)) (or nil (swap! n inc) (swap! n inc)) @n", "1"},
+		{"(def! n (atom 0)) (and (swap! n inc) (swap! n inc)) @n", "2"},
+		{"(def! n (atom 0)) [(or (do (swap! n inc) nil) false) @n]", "[false 1]"},
+	})
+}
+
+func TestAndOrKeepTailCalls(t *testing.T) {
+	for _, op := range []string{"(and true", "(or false"} {
+		input := "(def! f (fn* [n] " + op + " (if (= n 0) :done (f (- n 1)))))) (f 1000)"
+		value, err := eval(NewInterpreter(Limits{MaxDepth: 100}), input)
+		if err != nil {
+			t.Errorf("%s: %s", input, PRINT(err))
+		} else if PRINT(value) != ":done" {
+			t.Errorf("%s: expected :done, got %s", input, PRINT(value))
+		}
+	}
+}
+
+func TestCatchUnwrapsReasons(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(try* (throw {:a 1}) (catch* e e))", "{:a 1}"},
+		{"(try* (throw {:a 1}) (catch* e (get e :a)))", "1"},
+		{"(try* (throw {:a 1}) (catch* e (map? e)))", "true"},
+		{"(try* (throw :boom) (catch* e e))", ":boom"},
+		{"(try* (throw :boom) (catch* e (keyword? e)))", "true"},
+		{"(try* (throw :boom) (catch* e (= e :boom)))", "true"},
+		{"(def! v [1 2]) (try* (throw v) (catch* e (identical? e v)))", "true"},
+		{"(try* (throw nil) (catch* e (nil? e)))", "true"},
+		{"(try* (try* (throw {:a 1}) (catch* e (throw (assoc e :b 2)))) (catch* e e))", "{:a 1 :b 2}"},
+		{"(throw {:a 1})", "error: {:a 1}"},
+		{"(throw :boom)", "error: :boom"},
+	})
+}
+
+func TestExInfo(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{`(try* (throw (ex-info "boom" {:a 1})) (catch* e (ex-data e)))`, "{:a 1}"},
+		{`(try* (throw (ex-info "boom" {:a 1})) (catch* e (ex-message e)))`, `"boom"`},
+		{`(try* (throw (ex-info "boom" {:a {:b [1 2]}})) (catch* e (get-in (ex-data e) [:a :b])))`, "[1 2]"},
+		{`(def! data {:a 1}) (try* (throw (ex-info "boom" data)) (catch* e (identical? data (ex-data e))))`, "true"},
+		{`(ex-data (ex-info "boom" {}))`, "{}"},
+		{`(try* (throw {:a 1}) (catch* e (ex-data e)))`, "nil"},
+		{`(try* (throw "plain") (catch* e (ex-data e)))`, "nil"},
+		{`(ex-data 1)`, "nil"},
+		{`(ex-info "boom")`, "error: ex-info requires 2 args"},
+		{`(ex-info :boom {})`, "error: ex-info requires a string message"},
+		{`(ex-info "boom" [])`, "error: ex-info requires a data map"},
+		{`(ex-data)`, "error: ex-data requires 1 arg"},
+	})
+}
+
+func TestWithRedefs(t *testing.T) {
+	const defs = "(def! greet (fn* [] :real)) (def! call-greet (fn* [] (greet))) "
+	evalTests(t, []struct{ input, expected string }{
+		{defs + "(with-redefs [greet (fn* [] :stub)] (call-greet))", ":stub"},
+		{defs + "(with-redefs [greet (fn* [] :stub)] (greet))", ":stub"},
+		{defs + "(with-redefs [greet (fn* [] :stub)] (call-greet)) (call-greet)", ":real"},
+		{defs + "(try* (with-redefs [greet (fn* [] :stub)] (throw :boom)) (catch* e e)) (call-greet)", ":real"},
+		{defs + "(try* (with-redefs [greet (fn* [] (throw :boom))] (call-greet)) (catch* e e))", ":boom"},
+		{defs + "(with-redefs [greet (fn* [] :outer)] (with-redefs [greet (fn* [] :inner)] (call-greet)))", ":inner"},
+		{defs + "(with-redefs [greet (fn* [] :outer)] (with-redefs [greet (fn* [] :inner)] 1) (call-greet))", ":outer"},
+		{defs + "(with-redefs [greet (fn* [] :stub)] (call-greet) (call-greet))", ":stub"},
+		{defs + "(with-redefs [greet (fn* [] :stub)])", "nil"},
+		{defs + "(let* [greet (fn* [] :local)] (with-redefs [greet (fn* [] :stub)] [(greet) (call-greet)]))", "[:stub :stub]"},
+		{"(with-redefs [undefined-var 1] 1)", "error: with-redefs requires a defined var: undefined-var"},
+		{"(def! x 1) (with-redefs [x] x)", "error: with-redefs requires an even list of bindings"},
+		{"(with-redefs [1 2] 1)", "error: with-redefs binding arg requires a symbol"},
+		{"(with-redefs x 1)", "error: with-redefs requires a binding sequential arg"},
+		{"(with-redefs)", "error: with-redefs requires a binding arg"},
+	})
+}
+
+// captureStdout returns what f writes to stdout
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+	output := make(chan string)
+	go func() {
+		b, _ := ioutil.ReadAll(r)
+		output <- string(b)
+	}()
+	f()
+	w.Close()
+	return <-output
+}
+
+func TestRunTests(t *testing.T) {
+	var value types.MalType
+	var err error
+	printed := captureStdout(t, func() {
+		value, err = eval(NewInterpreter(Limits{}), `
+			(deftest passing (is (= 2 (+ 1 1))) (is true))
+			(deftest failing (is (= 1 2)) (is (= 1 1)))
+			(deftest erroring (is (throw :boom)))
+			(run-tests)`)
+	})
+	if err != nil {
+		t.Fatal(PRINT(err))
+	}
+	expected := "{:test 3 :pass 3 :fail 1 :error 1}"
+	if PRINT(value) != expected {
+		t.Errorf("run-tests returned %s, not %s", PRINT(value), expected)
+	}
+	for _, line := range []string{
+		"FAIL in failing (= 1 2)",
+		"ERROR in erroring (throw :boom)",
+		"Ran 3 tests: 3 passed, 1 failed, 1 errors.",
+	} {
+		if !strings.Contains(printed, line) {
+			t.Errorf("run-tests printed %q, without %q", printed, line)
+		}
+	}
+}
+
+func TestRethrow(t *testing.T) {
+	const boom = `(ex-info "boom" {:a 1})`
+	evalTests(t, []struct{ input, expected string }{
+		{"(try* (try* (throw " + boom + ") (catch* e (throw e))) (catch* e (ex-data e)))", "{:a 1}"},
+		{"(try* (try* (throw " + boom + ") (catch* e (throw e))) (catch* e (ex-message e)))", `"boom"`},
+		{"(try* (try* (throw " + boom + ") (catch* e (throw e))) (catch* ExInfo e :ex-info) (catch* e :other))", ":ex-info"},
+		{"(try* (try* (try* (throw " + boom + ") (catch* e (throw e))) (catch* e (throw e))) (catch* e (ex-data e)))", "{:a 1}"},
+		{"(def! ex " + boom + ") (try* (try* (throw ex) (catch* e (throw e))) (catch* e (= e ex)))", "true"},
+		{"(try* (try* (throw {:a 1}) (catch* e (throw e))) (catch* e e))", "{:a 1}"},
+		{"(try* (try* (throw " + boom + ") (catch* e (throw e))) (catch* e (ex-data (ex-data e))))", "nil"},
+		{"(try* (throw " + boom + ") (catch* e (throw e)))", `error: #ex-info {:message "boom" :data {:a 1}}`},
+		{"(throw)", "error: throw requires 1 arg"},
+	})
+}
+
+func TestPrnTruncatesInfiniteSeqs(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(prn (range))", "(0 1 2 3 4 5 6 7 8 9 ...)\n"},
+		{"(prn [(range)])", "[(0 1 2 3 4 5 6 7 8 9 ...)]\n"},
+		{"(prn (concat [:a] (range)))", "(:a 0 1 2 3 4 5 6 7 8 ...)\n"},
+		{"(prn (drop 5 (range)))", "(5 6 7 8 9 10 11 12 13 14 ...)\n"},
+		{"(println (range))", "(0 1 2 3 4 5 6 7 8 9 ...)\n"},
+		{"(prn (range 12))", "(0 1 2 3 4 5 6 7 8 9 10 11)\n"},
+		{"(def! *print-length* 3) (prn (range))", "(0 1 2 ...)\n"},
+		{"(def! *print-length* 3) (prn (range 12))", "(0 1 2 ...)\n"},
+		{"(def! *print-length* 3) (prn [1 2 3 4])", "[1 2 3 ...]\n"},
+		{"(def! *print-length* 20) (prn (range))", "(0 1 2 3 4 5 6 7 8 9 10 11 12 13 14 15 16 17 18 19 ...)\n"},
+		{"(def! *print-length* 3) (prn (range 3))", "(0 1 2)\n"},
+	}
+	for _, test := range tests {
+		var err error
+		printed := captureStdout(t, func() {
+			_, err = eval(NewInterpreter(Limits{}), test.input)
+		})
+		if err != nil {
+			t.Errorf("%s: %s", test.input, PRINT(err))
+		} else if printed != test.expected {
+			t.Errorf("%s: expected %q, got %q", test.input, test.expected, printed)
+		}
+	}
+	evalTests(t, []struct{ input, expected string }{
+		{"(pr-str (range))", `"(0 1 2 3 4 5 6 7 8 9 ...)"`},
+		{"(str (range))", `"(0 1 2 3 4 5 6 7 8 9 ...)"`},
+		{"(def! *print-length* 3) (pr-str (range))", `"(0 1 2 ...)"`},
+	})
+}
+
+func TestOddArgErrorsThroughApply(t *testing.T) {
+	evalTests(t, []struct{ input, expected string }{
+		{"(apply hash-map [:a 1 :b])", "error: hash-map requires an even number of args, got 3"},
+		{"(apply assoc {} [:a 1 :b])", "error: assoc requires an even number of key and value args, got 3"},
+	})
+}
@@ -1,71 +1,253 @@
 package printer
 
 import (
+	"bufio"
 	"fmt"
+	"io"
+	"sort"
 	"strconv"
 	"strings"
+	"unicode"
 
-	"github.com/dball/glimpse/runtime"
+	"github.com/dball/glimpse/ex"
 	"github.com/dball/glimpse/types"
 )
 
 // Config controls printing behavior
 type Config struct {
-	Readably     bool
+	Readably bool
+	// MaxSeqLength limits the items printed from each collection, if positive
 	MaxSeqLength int
+	// MaxDepth limits the nesting of printed collections, if positive,
+	// printing # in place of collections nested more deeply
+	MaxDepth int
+}
+
+// defaultSeqLength limits the items printed from seqs which may be infinite
+const defaultSeqLength = 10
+
+func init() {
+	types.PrintedForm = func(value types.MalType) string {
+		return PrintStr(Config{Readably: true}, value)
+	}
 }
 
 // PrintStr prints values
 func PrintStr(config Config, value types.MalType) string {
+	var sb strings.Builder
+	Fprint(&sb, config, value)
+	return sb.String()
+}
+
+// Fprint prints values directly to a writer, returning the first write error
+func Fprint(w io.Writer, config Config, value types.MalType) error {
+	bw := bufio.NewWriter(w)
+	p := printer{w: bw, config: config}
+	p.print(value)
+	if p.err != nil {
+		return p.err
+	}
+	return bw.Flush()
+}
+
+// Fprintln prints values separated by spaces and followed by a newline
+// directly to a writer, returning the first write error
+func Fprintln(w io.Writer, config Config, values ...types.MalType) error {
+	bw := bufio.NewWriter(w)
+	p := printer{w: bw, config: config}
+	for i, value := range values {
+		if i > 0 {
+			p.writeRune(' ')
+		}
+		p.print(value)
+	}
+	p.writeRune('\n')
+	if p.err != nil {
+		return p.err
+	}
+	return bw.Flush()
+}
+
+// printer writes printed values, retaining the first write error
+type printer struct {
+	w      *bufio.Writer
+	config Config
+	err    error
+	depth  int
+}
+
+func (p *printer) writeString(s string) {
+	if p.err == nil {
+		_, p.err = p.w.WriteString(s)
+	}
+}
+
+func (p *printer) writeRune(r rune) {
+	if p.err == nil {
+		_, p.err = p.w.WriteRune(r)
+	}
+}
+
+func (p *printer) print(value types.MalType) {
 	switch v := value.(type) {
 	case types.Integer:
-		return strconv.FormatInt(int64(v), 10)
+		p.writeString(strconv.FormatInt(int64(v), 10))
+	case types.BigInt:
+		p.writeString(v.Int.String())
 	case types.Symbol:
-		return v.Name
+		p.writeString(v.Name)
 	case types.List:
-		return printSeq(config, v.Seq(), "(", ")")
+		if !p.printSugar(v) {
+			p.printSeq(v.Seq(), "(", ")", p.config.MaxSeqLength)
+		}
 	case types.Vector:
-		return printSeq(config, v.Seq(), "[", "]")
+		p.printSeq(v.Seq(), "[", "]", p.config.MaxSeqLength)
 	case types.Map:
-		return printMap(config, v)
+		p.printMap(v)
+	case types.Queue:
+		p.printSeq(v.Seq(), "#queue (", ")", p.config.MaxSeqLength)
 	case types.String:
-		return printString(config, v)
+		p.printString(v)
 	case types.Rune:
-		return printRune(config, v)
+		p.printRune(v)
 	case types.Function:
-		return "#FN"
+		if v.Name != "" {
+			p.writeString("#<fn " + v.Name + ">")
+		} else {
+			p.writeString("#FN")
+		}
 	case types.Keyword:
-		return ":" + v.Name
+		p.writeRune(':')
+		p.writeString(v.Name)
 	case types.Boolean:
 		if v {
-			return "true"
+			p.writeString("true")
+		} else {
+			p.writeString("false")
 		}
-		return "false"
 	case types.Nil:
-		return "nil"
+		p.writeString("nil")
 	case *types.Atom:
-		return "(atom " + PrintStr(config, v.Value) + ")"
+		value, _ := v.Deref()
+		p.writeString("(atom ")
+		p.print(value)
+		p.writeRune(')')
+	case *types.Promise:
+		p.writeString("#promise")
+	case *types.Delay:
+		p.writeString("#delay")
+	case *types.Future:
+		p.writeString("#future")
+	case *types.Volatile:
+		p.writeString("#volatile")
+	case *types.StringBuilder:
+		p.writeString("#string-builder")
+	case *types.MutableArray:
+		p.printSeq(v.Seq(), "#array [", "]", p.config.MaxSeqLength)
 	case types.Seq:
-		// TODO config length
-		seq, rest, _ := runtime.TakeDrop(types.Integer(10), v)
-		empty, _ := runtime.Empty(rest)
-		var last = ")"
-		if !empty {
-			last = " ... )"
-		}
-		return printSeq(config, seq, "(", last)
+		limit := p.config.MaxSeqLength
+		if limit <= 0 && !finite(v) {
+			limit = defaultSeqLength
+		}
+		p.printSeq(v, "(", ")", limit)
 	case types.MalError:
-		return PrintStr(config, v.Reason)
+		if v.Reason == nil {
+			p.writeString("nil")
+		} else {
+			p.print(v.Reason)
+		}
+	case ex.Ex:
+		p.printEx(v)
+	case types.ExInfo:
+		p.writeString("#ex-info ")
+		p.print(types.NewMap(types.NewKeyword("message"), types.String(v.Message), types.NewKeyword("data"), v.Data))
 	case error:
-		return printString(config, types.String(v.Error()))
+		// Error messages are not strings in the language, so they are never
+		// quoted, e.g. reader errors
+		p.writeString(v.Error())
 	default:
-		return fmt.Sprintf("#UNKNOWN: %v", value)
+		p.writeString(fmt.Sprintf("#UNKNOWN: %v", value))
 	}
 }
 
-func printSeq(config Config, seq types.Seq, first string, last string) string {
-	var sb strings.Builder
-	sb.WriteString(first)
+// finite is true if a seq is known to end, so it needs no default limit
+func finite(seq types.Seq) bool {
+	switch s := seq.(type) {
+	case types.Counted, types.ListIteratorSeq:
+		return true
+	case types.Range:
+		return s.Finite
+	case types.Concatenation:
+		for _, part := range s.Seqs {
+			if !finite(part) {
+				return false
+			}
+		}
+		return true
+	default:
+		return false
+	}
+}
+
+// readerSugar maps the wrapping symbols produced by reader macros to their prefixes
+var readerSugar = map[string]string{
+	"quote":          "'",
+	"quasiquote":     "`",
+	"unquote":        "~",
+	"splice-unquote": "~@",
+	"deref":          "@",
+}
+
+// printSugar prints single-arg reader macro forms using their reader prefix
+func (p *printer) printSugar(list types.List) bool {
+	if list.Imm.Len() != 2 {
+		return false
+	}
+	symbol, valid := list.Imm.Get(0).(types.Symbol)
+	if !valid {
+		return false
+	}
+	prefix, found := readerSugar[symbol.Name]
+	if !found {
+		return false
+	}
+	p.writeString(prefix)
+	// ~@ reads as splice-unquote, so an unquoted deref is printed as ~ @
+	if symbol.Name == "unquote" && isSugar(list.Imm.Get(1), "deref") {
+		p.writeRune(' ')
+	}
+	p.print(list.Imm.Get(1))
+	return true
+}
+
+// isSugar is true if the value is a single-arg form of the named reader macro
+func isSugar(value types.MalType, name string) bool {
+	list, valid := value.(types.List)
+	if !valid || list.Imm.Len() != 2 {
+		return false
+	}
+	symbol, valid := list.Imm.Get(0).(types.Symbol)
+	return valid && symbol.Name == name
+}
+
+// enter begins printing a nested collection, returning false and printing #
+// in its place if it is nested too deeply
+func (p *printer) enter() bool {
+	if p.config.MaxDepth > 0 && p.depth >= p.config.MaxDepth {
+		p.writeRune('#')
+		return false
+	}
+	p.depth++
+	return true
+}
+
+// printSeq prints the items of a seq between delimiters, eliding those
+// beyond the limit, if positive
+func (p *printer) printSeq(seq types.Seq, first string, last string, limit int) {
+	if !p.enter() {
+		return
+	}
+	p.writeString(first)
 	i := 0
 	for {
 		empty, head, tail := seq.Next()
@@ -73,78 +255,109 @@ func printSeq(config Config, seq types.Seq, first string, last string) string {
 			break
 		}
 		if i > 0 {
-			sb.WriteRune(' ')
+			p.writeRune(' ')
+		}
+		if limit > 0 && i == limit {
+			p.writeString("...")
+			break
 		}
 		i++
-		sb.WriteString(PrintStr(config, head))
+		p.print(head)
 		seq = tail
 	}
-	sb.WriteString(last)
-	return sb.String()
+	p.writeString(last)
+	p.depth--
 }
 
-func printMap(config Config, m types.Map) string {
-	var sb strings.Builder
-	sb.WriteRune('{')
-	var i int
-	imm := m.Imm
-	itr := imm.Iterator()
-	for !itr.Done() {
+func (p *printer) printMap(m types.Map) {
+	if !p.enter() {
+		return
+	}
+	p.writeRune('{')
+	keys, vals := m.Entries()
+	for i, k := range keys {
 		if i > 0 {
-			sb.WriteRune(' ')
+			p.writeRune(' ')
 		}
-		i++
-		k, v := itr.Next()
-		sb.WriteString(PrintStr(config, k))
-		sb.WriteRune(' ')
-		sb.WriteString(PrintStr(config, v))
+		if p.config.MaxSeqLength > 0 && i == p.config.MaxSeqLength {
+			p.writeString("...")
+			break
+		}
+		p.print(k)
+		p.writeRune(' ')
+		p.print(vals[i])
 	}
-	sb.WriteRune('}')
-	return sb.String()
+	p.writeRune('}')
+	p.depth--
 }
 
 // When print_readably is true, doublequotes, newlines, and backslashes are translated into their printed representations (the reverse of the reader)
-func printString(config Config, s types.String) string {
-	if !config.Readably {
-		return string(s)
+func (p *printer) printString(s types.String) {
+	if !p.config.Readably {
+		p.writeString(string(s))
+		return
 	}
-	var sb strings.Builder
-	sb.WriteRune('"')
-	runes := []rune(s)
-	for _, r := range runes {
+	p.writeRune('"')
+	for _, r := range string(s) {
 		switch r {
 		case '"':
-			sb.WriteString(`\"`)
+			p.writeString(`\"`)
 		case '\\':
-			sb.WriteString(`\\`)
+			p.writeString(`\\`)
 		case '\n':
-			sb.WriteString(`\n`)
+			p.writeString(`\n`)
 		default:
-			sb.WriteRune(r)
+			p.writeRune(r)
 		}
 	}
-	sb.WriteRune('"')
-	return sb.String()
+	p.writeRune('"')
 }
 
-func printRune(config Config, r types.Rune) string {
-	if !config.Readably {
-		var sb strings.Builder
-		sb.WriteRune(rune(r))
-		return sb.String()
+func (p *printer) printRune(r types.Rune) {
+	if !p.config.Readably {
+		p.writeRune(rune(r))
+		return
 	}
 	switch rune(r) {
 	case '\n':
-		return `\newline`
+		p.writeString(`\newline`)
 	case '\r':
-		return `\return`
+		p.writeString(`\return`)
 	case ' ':
-		return `\space`
+		p.writeString(`\space`)
 	case '\t':
-		return `\tab`
+		p.writeString(`\tab`)
+	default:
+		// Unprintable runes are written as unicode escapes, which the reader
+		// reads back
+		if !unicode.IsPrint(rune(r)) && r <= 0xffff {
+			p.writeString(fmt.Sprintf(`\u%04x`, rune(r)))
+			return
+		}
+		p.writeRune('\\')
+		p.writeRune(rune(r))
 	}
-	var sb strings.Builder
-	sb.WriteRune('\\')
-	sb.WriteRune(rune(r))
-	return sb.String()
+}
+
+// printEx prints an ex as a tagged map of its code, context, and cause
+func (p *printer) printEx(e ex.Ex) {
+	entries := []types.MalType{types.NewKeyword("code"), types.String(e.Code)}
+	if len(e.Context) > 0 {
+		// Small maps print in insertion order, so the context is sorted
+		names := make([]string, 0, len(e.Context))
+		for name := range e.Context {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		var context []types.MalType
+		for _, name := range names {
+			context = append(context, types.NewKeyword(name), e.Context[name])
+		}
+		entries = append(entries, types.NewKeyword("context"), types.NewMap(context...))
+	}
+	if e.Err != nil {
+		entries = append(entries, types.NewKeyword("cause"), types.String(e.Err.Error()))
+	}
+	p.writeString("#error ")
+	p.print(types.NewMap(entries...))
 }
@@ -0,0 +1,180 @@
+package printer
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+
+	"github.com/dball/glimpse/ex"
+	"github.com/dball/glimpse/reader"
+	"github.com/dball/glimpse/types"
+)
+
+func TestPrintEx(t *testing.T) {
+	tests := []struct {
+		value    ex.Ex
+		expected string
+	}{
+		{ex.Ex{Code: "Invalid type"}, `#error {:code "Invalid type"}`},
+		{
+			ex.Ex{Code: "Invalid value", Err: errors.New("too big")},
+			`#error {:code "Invalid value" :cause "too big"}`,
+		},
+		{
+			ex.Ex{Code: "Invalid value", Context: map[string]interface{}{
+				"z": types.Integer(1), "a": types.Integer(2), "m": types.String("x"),
+				"b": types.Integer(3), "y": types.Integer(4), "c": types.Integer(5),
+			}},
+			`#error {:code "Invalid value" :context {:a 2 :b 3 :c 5 :m "x" :y 4 :z 1}}`,
+		},
+	}
+	for _, test := range tests {
+		// Go randomizes map iteration, so printing repeatedly exposes any
+		// dependence on it
+		for i := 0; i < 10; i++ {
+			if actual := PrintStr(Config{Readably: true}, test.value); actual != test.expected {
+				t.Errorf("expected %s, got %s", test.expected, actual)
+				break
+			}
+		}
+	}
+}
+
+func TestPrintRune(t *testing.T) {
+	tests := []struct {
+		value    types.Rune
+		readably string
+		plainly  string
+	}{
+		{'a', `\a`, "a"},
+		{'(', `\(`, "("},
+		{'"', `\"`, `"`},
+		{'\\', `\\`, `\`},
+		{'λ', `\λ`, "λ"},
+		{'\n', `\newline`, "\n"},
+		{'\r', `\return`, "\r"},
+		{' ', `\space`, " "},
+		{'\t', `\tab`, "\t"},
+		{'\a', `\u0007`, "\a"},
+	}
+	for _, test := range tests {
+		if actual := PrintStr(Config{Readably: true}, test.value); actual != test.readably {
+			t.Errorf("%q printed readably as %s, not %s", rune(test.value), actual, test.readably)
+		}
+		if actual := PrintStr(Config{}, test.value); actual != test.plainly {
+			t.Errorf("%q printed as %s, not %s", rune(test.value), actual, test.plainly)
+		}
+	}
+}
+
+func TestPrintReaderSugar(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"(quote x)", "'x"},
+		{"(quasiquote (a b))", "`(a b)"},
+		{"(unquote x)", "~x"},
+		{"(splice-unquote xs)", "~@xs"},
+		{"(deref a)", "@a"},
+		{"(quasiquote (a (unquote b) (splice-unquote cs)))", "`(a ~b ~@cs)"},
+		{"(quote (quote x))", "''x"},
+		{"(unquote (deref a))", "~ @a"},
+		{"(splice-unquote (deref a))", "~@@a"},
+		{"[(quote x) {:k (deref a)}]", "['x {:k @a}]"},
+		{"(quote)", "(quote)"},
+		{"(quote x y)", "(quote x y)"},
+		{"[quote x]", "[quote x]"},
+	}
+	for _, test := range tests {
+		form, err := reader.ReadStr(test.input)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual := PrintStr(Config{Readably: true}, form)
+		if actual != test.expected {
+			t.Errorf("%s: printed %s, not %s", test.input, actual, test.expected)
+			continue
+		}
+		reread, err := reader.ReadStr(actual)
+		if err != nil {
+			t.Errorf("%s: %v", actual, err)
+			continue
+		}
+		if !types.Equals(reread, form) {
+			t.Errorf("%s: reads back as %s", actual, PrintStr(Config{Readably: true}, reread))
+		}
+	}
+}
+
+func TestFprintMatchesPrintStr(t *testing.T) {
+	values := []types.MalType{
+		types.Nil{},
+		types.String("a \"b\""),
+		types.NewVector(types.Integer(1), types.NewKeyword("k"), types.Rune('c')),
+		types.NewMap(types.NewKeyword("a"), types.NewList(types.String("x"))),
+		types.Range{Step: 1},
+		ex.Ex{Code: "Invalid type"},
+	}
+	configs := []Config{{}, {Readably: true}, {Readably: true, MaxSeqLength: 2, MaxDepth: 1}}
+	for _, config := range configs {
+		for _, value := range values {
+			var buf bytes.Buffer
+			if err := Fprint(&buf, config, value); err != nil {
+				t.Fatal(err)
+			}
+			if expected := PrintStr(config, value); buf.String() != expected {
+				t.Errorf("%+v: Fprint wrote %s, PrintStr returned %s", config, buf.String(), expected)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := Fprintln(&buf, Config{Readably: true}, types.String("a"), types.Integer(1)); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "\"a\" 1\n" {
+		t.Errorf("Fprintln wrote %q", buf.String())
+	}
+}
+
+// chunkWriter records the size of the largest write
+type chunkWriter struct {
+	total, largest int
+}
+
+func (w *chunkWriter) Write(b []byte) (int, error) {
+	w.total += len(b)
+	if len(b) > w.largest {
+		w.largest = len(b)
+	}
+	return len(b), nil
+}
+
+// failingWriter fails every write
+type failingWriter struct{}
+
+func (failingWriter) Write(b []byte) (int, error) {
+	return 0, errors.New("closed")
+}
+
+func TestFprintStreams(t *testing.T) {
+	items := make([]types.MalType, 100000)
+	for i := range items {
+		items[i] = types.String(strings.Repeat("x", 10))
+	}
+	large := types.NewVector(items...)
+	var w chunkWriter
+	if err := Fprint(&w, Config{Readably: true}, large); err != nil {
+		t.Fatal(err)
+	}
+	if expected := len(PrintStr(Config{Readably: true}, large)); w.total != expected {
+		t.Errorf("streamed %d bytes, not %d", w.total, expected)
+	}
+	if w.largest > 64*1024 {
+		t.Errorf("wrote %d bytes at once rather than streaming", w.largest)
+	}
+	if err := Fprint(failingWriter{}, Config{}, large); err == nil || err.Error() != "closed" {
+		t.Errorf("expected the write error, got %v", err)
+	}
+}
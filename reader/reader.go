@@ -1,38 +1,184 @@
 package reader
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"io"
+	"math/big"
 	"regexp"
+	"sort"
 	"strconv"
+	"strings"
 
 	"github.com/dball/glimpse/types"
 )
 
-var tokenRegexp = regexp.MustCompile(`[\s,]*(~@|[\[\]{}()'` + "`" +
-	`~^@]|"(?:\\.|[^\\"])*"?|;.*|[^\s\[\]{}('"` + "`" +
+var tokenRegexp = regexp.MustCompile(`[\s,]*(~@|#=|[\[\]{}()'` + "`" +
+	`~^@]|"(?:\\.|[^\\"])*"?|;.*|\\.[^\s\[\]{}('"` + "`" +
+	`,;)]*|[^\s\[\]{}('"` + "`" +
 	`,;)]*)`)
 
 var integerRegexp = regexp.MustCompile(`^-?\d+$`)
 
-// Reader reads tokens
+// numberRegexp matches tokens which begin like numbers
+var numberRegexp = regexp.MustCompile(`^[-+]?\d`)
+
+// ErrReadEval is wrapped by errors from read-eval forms when they are disabled
+var ErrReadEval = errors.New("read-eval is disabled")
+
+// Options are feature flags controlling what the reader accepts
+type Options struct {
+	// ReadEval allows #= forms, which are read as (eval form)
+	ReadEval bool
+	// PromoteIntegers reads integer literals beyond int64 as big integers
+	// rather than rejecting them
+	PromoteIntegers bool
+}
+
+// ErrUnbalanced is wrapped by errors from input ending inside a list, vector,
+// map, or string, distinguishing incomplete input from input with no forms at
+// all
+var ErrUnbalanced = errors.New("unbalanced delimiters")
+
+// Reader reads tokens, refilling them line by line from its source if it has one
 type Reader struct {
-	tokens []string
-	offset int
+	tokens    []string
+	positions []int
+	offset    int
+	source    *bufio.Reader
+	pending   string
+	consumed  int
+	options   Options
+	// lines holds the byte offsets at which each line of input starts
+	lines []int
+	read  int
+}
+
+// NewReader builds a reader of successive forms from a stream
+func NewReader(r io.Reader) *Reader {
+	return NewReaderWithOptions(r, Options{})
+}
+
+// NewReaderWithOptions builds a reader of successive forms from a stream
+// with the given options
+func NewReaderWithOptions(r io.Reader, options Options) *Reader {
+	return &Reader{source: bufio.NewReader(r), options: options, lines: []int{0}}
+}
+
+// Read reads the next form from the reader's input, returning io.EOF if
+// there are no more forms
+func (reader *Reader) Read() (types.MalType, error) {
+	for {
+		token := reader.peek()
+		if token == nil {
+			return nil, io.EOF
+		}
+		if (*token)[0] != ';' {
+			break
+		}
+		reader.next()
+	}
+	form, err := readForm(reader)
+	reader.tokens = reader.tokens[reader.offset:]
+	reader.positions = reader.positions[reader.offset:]
+	reader.offset = 0
+	return form, err
+}
+
+// fill reads lines from the source until more tokens are available,
+// returning false if the source is exhausted. A string token left open at
+// the end of a line is held back until the rest of it is read.
+func (reader *Reader) fill() bool {
+	for reader.source != nil {
+		line, err := reader.source.ReadString('\n')
+		if err != nil {
+			reader.source = nil
+		}
+		reader.read += len(line)
+		if strings.HasSuffix(line, "\n") {
+			reader.lines = append(reader.lines, reader.read)
+		}
+		text := reader.pending + line
+		base := reader.consumed
+		tokens, positions := tokenize(text)
+		reader.pending = ""
+		last := len(tokens) - 1
+		if reader.source != nil && last >= 0 && unterminatedString(tokens[last]) {
+			reader.pending = text[positions[last]:]
+			tokens = tokens[:last]
+			positions = positions[:last]
+		}
+		reader.consumed = base + len(text) - len(reader.pending)
+		for i, token := range tokens {
+			reader.tokens = append(reader.tokens, token)
+			reader.positions = append(reader.positions, base+positions[i])
+		}
+		if len(tokens) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// unterminatedString is true if the token opens a string but does not close it
+func unterminatedString(token string) bool {
+	if token[0] != '"' {
+		return false
+	}
+	if len(token) == 1 || token[len(token)-1] != '"' {
+		return true
+	}
+	slashes := 0
+	for i := len(token) - 2; i > 0 && token[i] == '\\'; i-- {
+		slashes++
+	}
+	return slashes%2 == 1
 }
 
 // Error is a reader error
 type Error struct {
 	Message string
 	Err     error
+	// Line and Column locate the error in the input, starting from 1, if known
+	Line   int
+	Column int
 }
 
 func (err Error) Unwrap() error { return err.Err }
 
 func (err Error) String() string {
-	return fmt.Sprintf("reader error: %v: %v", err.Message, err.Err)
+	return err.Error()
 }
 func (err Error) Error() string {
-	return fmt.Sprintf("reader error: %v: %v", err.Message, err.Err)
+	var sb strings.Builder
+	sb.WriteString("reader error")
+	if err.Line > 0 {
+		fmt.Fprintf(&sb, " at %d:%d", err.Line, err.Column)
+	}
+	sb.WriteString(": ")
+	sb.WriteString(err.Message)
+	if err.Err != nil {
+		sb.WriteString(": ")
+		sb.WriteString(err.Err.Error())
+	}
+	return sb.String()
+}
+
+// locate sets the line and column of a reader error which has none from a
+// byte offset in the input
+func (reader *Reader) locate(err error, offset int) error {
+	readerErr, valid := err.(Error)
+	if !valid || readerErr.Line > 0 {
+		return err
+	}
+	if len(reader.lines) == 0 {
+		reader.lines = []int{0}
+	}
+	line := sort.SearchInts(reader.lines, offset+1)
+	readerErr.Line = line
+	readerErr.Column = offset - reader.lines[line-1] + 1
+	return readerErr
 }
 
 // Comment is an error indicating no token
@@ -43,7 +189,7 @@ func (Comment) Error() string {
 }
 
 func (reader *Reader) peek() *string {
-	if reader.offset == len(reader.tokens) {
+	if reader.offset == len(reader.tokens) && !reader.fill() {
 		return nil
 	}
 	return &reader.tokens[reader.offset]
@@ -57,18 +203,48 @@ func (reader *Reader) next() *string {
 	return token
 }
 
-func tokenize(s string) []string {
-	matches := tokenRegexp.FindAllStringSubmatch(s, -1)
-	tokens := make([]string, len(matches))
-	for i, match := range matches {
-		tokens[i] = match[1]
+// position returns the byte offset in the input of the next token
+func (reader *Reader) position() int {
+	if reader.offset == len(reader.positions) {
+		if reader.offset == 0 {
+			return 0
+		}
+		return reader.positions[reader.offset-1]
+	}
+	return reader.positions[reader.offset]
+}
+
+// tokenize returns the tokens in a string and their byte offsets
+func tokenize(s string) ([]string, []int) {
+	matches := tokenRegexp.FindAllStringSubmatchIndex(s, -1)
+	tokens := make([]string, 0, len(matches))
+	positions := make([]int, 0, len(matches))
+	for _, match := range matches {
+		// Trailing whitespace and commas match as empty tokens
+		if match[2] == match[3] {
+			continue
+		}
+		tokens = append(tokens, s[match[2]:match[3]])
+		positions = append(positions, match[2])
 	}
-	return tokens
+	return tokens, positions
 }
 
 // ReadStr reads strings
 func ReadStr(s string) (types.MalType, error) {
-	return readForm(&Reader{tokenize(s), 0})
+	return ReadStrWithOptions(s, Options{})
+}
+
+// ReadStrWithOptions reads strings with the given options
+func ReadStrWithOptions(s string, options Options) (types.MalType, error) {
+	tokens, positions := tokenize(s)
+	lines := []int{0}
+	for i, r := range s {
+		if r == '\n' {
+			lines = append(lines, i+1)
+		}
+	}
+	return readForm(&Reader{tokens: tokens, positions: positions, options: options, lines: lines})
 }
 
 func readForm(reader *Reader) (types.MalType, error) {
@@ -76,17 +252,14 @@ Loop:
 	for {
 		token := reader.peek()
 		if token == nil {
-			return nil, Error{"Unexpected end of input reading form", nil}
+			return nil, reader.locate(Error{Message: "Unexpected end of input reading form"}, reader.position())
 		}
 		switch *token {
 		case "(":
-			reader.next()
 			return readList(reader, ")", types.NewList())
 		case "[":
-			reader.next()
 			return readList(reader, "]", types.NewVector())
 		case "{":
-			reader.next()
 			return readList(reader, "}", types.NewMap())
 		case "'":
 			return readQuotedForm(reader, "quote")
@@ -98,44 +271,75 @@ Loop:
 			return readQuotedForm(reader, "splice-unquote")
 		case "@":
 			return readQuotedForm(reader, "deref")
+		case "#=":
+			if !reader.options.ReadEval {
+				return nil, reader.locate(Error{Message: "Unsupported #= form", Err: ErrReadEval}, reader.position())
+			}
+			return readQuotedForm(reader, "eval")
 		default:
+			position := reader.position()
 			val, err := readAtom(reader)
 			if err != nil {
 				_, comment := err.(Comment)
 				if comment {
 					continue Loop
 				}
-				return nil, err
+				return nil, reader.locate(err, position)
 			}
 			return val, err
 		}
 	}
 }
 
+// skipComments advances past any comment tokens, returning the next token
+func skipComments(reader *Reader) *string {
+	token := reader.peek()
+	for token != nil && (*token)[0] == ';' {
+		reader.next()
+		token = reader.peek()
+	}
+	return token
+}
+
 func readQuotedForm(reader *Reader, name string) (types.MalType, error) {
+	start := reader.position()
 	reader.next()
+	if skipComments(reader) == nil {
+		return nil, reader.locate(Error{Message: "Unexpected end of input reading " + name, Err: ErrUnbalanced}, start)
+	}
 	form, err := readForm(reader)
 	if err != nil {
-		return nil, Error{"Unexpected end of quoted form: " + name, err}
+		return nil, err
 	}
 	return types.NewList(types.NewSymbol(name), form), nil
 }
 
+// readList reads the forms of a list through its end delimiter. Errors from
+// input ending within the list are located at its start.
 func readList(reader *Reader, end string, coll types.MalType) (types.MalType, error) {
+	start := reader.position()
+	reader.next()
 	var items []types.MalType
+	var last int
 Loop:
 	for {
+		if skipComments(reader) == nil {
+			return coll, reader.locate(Error{Message: "Unexpected end of input reading list", Err: ErrUnbalanced}, start)
+		}
+		position := reader.position()
 		value, err := readForm(reader)
 		if err != nil {
-			return coll, Error{"Error reading list", err}
+			return coll, err
 		}
-		switch value {
-		case types.Symbol{Name: end}:
+		if symbol, valid := value.(types.Symbol); valid && symbol.Name == end {
 			break Loop
+		}
+		switch value {
 		case nil:
-			return coll, Error{"Unexpected end of input reading list", nil}
+			return coll, reader.locate(Error{Message: "Unexpected end of input reading list", Err: ErrUnbalanced}, start)
 		default:
 			items = append(items, value)
+			last = position
 		}
 	}
 	switch coll.(type) {
@@ -145,11 +349,12 @@ Loop:
 		return types.NewVector(items...), nil
 	case types.Map:
 		if len(items)%2 != 0 {
-			return coll, Error{"Unbalanced map input", nil}
+			message := fmt.Sprintf("Unbalanced map input: read %d forms, the last here", len(items))
+			return coll, reader.locate(Error{Message: message}, last)
 		}
 		return types.NewMap(items...), nil
 	default:
-		return nil, Error{"Invalid list type", nil}
+		return nil, Error{Message: "Invalid list type"}
 	}
 }
 
@@ -158,7 +363,11 @@ func readAtom(reader *Reader) (types.MalType, error) {
 	if integerRegexp.MatchString(token) {
 		value, err := strconv.ParseInt(token, 10, 64)
 		if err != nil {
-			return nil, Error{"Unparseable integer", err}
+			if reader.options.PromoteIntegers && errors.Is(err, strconv.ErrRange) {
+				bigValue, _ := new(big.Int).SetString(token, 10)
+				return types.NewInteger(bigValue), nil
+			}
+			return nil, Error{Message: "Unparseable integer", Err: err}
 		}
 		return types.Integer(value), nil
 	}
@@ -169,7 +378,7 @@ func readAtom(reader *Reader) (types.MalType, error) {
 	case '"':
 		return parseString(runes)
 	case ':':
-		return types.NewKeyword(string(runes[1:])), nil
+		return parseKeyword(token)
 	case '\\':
 		return parseRune(runes[1:])
 	default:
@@ -181,15 +390,34 @@ func readAtom(reader *Reader) (types.MalType, error) {
 		case "nil":
 			return types.Nil{}, nil
 		default:
+			if numberRegexp.MatchString(token) {
+				return nil, Error{Message: "Invalid number: " + token}
+			}
 			return types.NewSymbol(token), nil
 		}
 	}
 }
 
+// parseKeyword reads a keyword token, rejecting the empty keyword : and
+// auto-resolved keywords like ::foo, since there are no namespaces to resolve
+// them in
+func parseKeyword(token string) (types.MalType, error) {
+	name := token[1:]
+	switch {
+	case name == "":
+		return nil, Error{Message: "Invalid keyword: keywords require a name"}
+	case name[0] == ':':
+		return nil, Error{Message: "Invalid keyword: auto-resolved keywords are not supported: " + token}
+	case name[len(name)-1] == ':':
+		return nil, Error{Message: "Invalid keyword: " + token}
+	}
+	return types.NewKeyword(name), nil
+}
+
 func parseString(runes []rune) (types.MalType, error) {
 	last := len(runes) - 1
-	if last == 0 || runes[last] != '"' {
-		return nil, Error{"String quotes are unbalanced", nil}
+	if unterminatedString(string(runes)) {
+		return nil, Error{Message: "String quotes are unbalanced", Err: ErrUnbalanced}
 	}
 	var result []rune
 	var escaping bool
@@ -209,13 +437,13 @@ func parseString(runes []rune) (types.MalType, error) {
 			case 'n':
 				result = append(result, '\n')
 			default:
-				return nil, Error{"String escape sequence is invalid", nil}
+				return nil, Error{Message: "String escape sequence is invalid"}
 			}
 			escaping = false
 		}
 	}
 	if escaping {
-		return nil, Error{"String slashes are unbalanced", nil}
+		return nil, Error{Message: "String slashes are unbalanced"}
 	}
 	return types.String(string(result)), nil
 }
@@ -225,7 +453,7 @@ func parseRune(runes []rune) (types.MalType, error) {
 	case 1:
 		return types.Rune(runes[0]), nil
 	case 0:
-		return nil, Error{"Invalid rune literal", nil}
+		return nil, Error{Message: "Invalid rune literal"}
 	}
 	switch string(runes) {
 	case "newline":
@@ -237,5 +465,12 @@ func parseRune(runes []rune) (types.MalType, error) {
 	case "tab":
 		return types.Rune('\t'), nil
 	}
-	return nil, Error{"Invalid rune literal", nil}
+	if len(runes) == 5 && runes[0] == 'u' {
+		code, err := strconv.ParseUint(string(runes[1:]), 16, 16)
+		if err != nil {
+			return nil, Error{Message: "Invalid unicode rune literal", Err: err}
+		}
+		return types.Rune(code), nil
+	}
+	return nil, Error{Message: "Invalid rune literal"}
 }
@@ -0,0 +1,346 @@
+package reader
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/dball/glimpse/printer"
+	"github.com/dball/glimpse/types"
+)
+
+func TestErrorsMatchSentinels(t *testing.T) {
+	_, err := ReadStr("#=(+ 1 2)")
+	if !errors.Is(err, ErrReadEval) {
+		t.Errorf("read-eval error %v does not match ErrReadEval", err)
+	}
+	wrapped := fmt.Errorf("loading: %w", err)
+	if !errors.Is(wrapped, ErrReadEval) {
+		t.Errorf("wrapped error %v does not match ErrReadEval", wrapped)
+	}
+	var readerErr Error
+	if !errors.As(wrapped, &readerErr) {
+		t.Fatalf("wrapped error %v is not a reader error", wrapped)
+	}
+	if readerErr.Line != 1 || readerErr.Column != 1 {
+		t.Errorf("reader error located at %d:%d", readerErr.Line, readerErr.Column)
+	}
+	if _, err := ReadStr(`"abc`); errors.Is(err, ErrReadEval) {
+		t.Errorf("string error %v matches ErrReadEval", err)
+	}
+}
+
+func TestCommasAreWhitespace(t *testing.T) {
+	one, two, three := types.Integer(1), types.Integer(2), types.Integer(3)
+	tests := []struct {
+		input    string
+		expected types.MalType
+	}{
+		{"(1,2,3)", types.NewList(one, two, three)},
+		{"[1, 2 ,3,]", types.NewVector(one, two, three)},
+		{"{:a 1, :b 2}", types.NewMap(types.NewKeyword("a"), one, types.NewKeyword("b"), two)},
+		{",,,(1),,,", types.NewList(one)},
+		{`"a,b"`, types.String("a,b")},
+		{`("a, b" , ",")`, types.NewList(types.String("a, b"), types.String(","))},
+		{`\,`, types.Rune(',')},
+	}
+	for _, test := range tests {
+		value, err := ReadStr(test.input)
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		if !types.Equals(value, test.expected) {
+			t.Errorf("%s read as %v, not %v", test.input, value, test.expected)
+		}
+	}
+}
+
+func TestRunesReadBackAsPrinted(t *testing.T) {
+	runes := []types.Rune{'a', 'λ', '(', ')', '[', '{', '"', ';', ',', '\\', '@', '\n', '\r', ' ', '\t', '\a', 0}
+	for _, r := range runes {
+		printed := printer.PrintStr(printer.Config{Readably: true}, r)
+		value, err := ReadStr(printed)
+		if err != nil {
+			t.Errorf("%s: %v", printed, err)
+			continue
+		}
+		if !types.Equals(value, r) {
+			t.Errorf("%s read as %v, not %q", printed, value, rune(r))
+		}
+	}
+	value, err := ReadStr(`[\( \u03bb]`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !types.Equals(value, types.NewVector(types.Rune('('), types.Rune('λ'))) {
+		t.Errorf("runes in a vector read as %v", value)
+	}
+	for _, invalid := range []string{`\uzzzz`, `\bogus`} {
+		if _, err := ReadStr(invalid); err == nil {
+			t.Errorf("read invalid rune %s", invalid)
+		}
+	}
+}
+
+func TestErrorPositions(t *testing.T) {
+	tests := []struct {
+		input        string
+		line, column int
+	}{
+		{"(foo\n  1\n  (bar \"abc", 3, 8},
+		{"\"abc", 1, 1},
+		{"(foo\n  [1 2]\n", 1, 1},
+		{"[1\n (a b\n c", 2, 2},
+		{"{:a 1\n :b}", 2, 2},
+	}
+	for _, test := range tests {
+		_, err := ReadStr(test.input)
+		var readerErr Error
+		if !errors.As(err, &readerErr) {
+			t.Errorf("%q: %v is not a reader error", test.input, err)
+			continue
+		}
+		if readerErr.Line != test.line || readerErr.Column != test.column {
+			t.Errorf("%q: error located at %d:%d, not %d:%d", test.input, readerErr.Line, readerErr.Column, test.line, test.column)
+		}
+	}
+}
+
+func TestStreamedErrorPositions(t *testing.T) {
+	reader := NewReader(strings.NewReader("(def! x 1)\n\n  (foo 1\n"))
+	if _, err := reader.Read(); err != nil {
+		t.Fatal(err)
+	}
+	_, err := reader.Read()
+	var readerErr Error
+	if !errors.As(err, &readerErr) {
+		t.Fatalf("%v is not a reader error", err)
+	}
+	if readerErr.Line != 3 || readerErr.Column != 3 {
+		t.Errorf("error located at %d:%d, not 3:3", readerErr.Line, readerErr.Column)
+	}
+}
+
+func TestIncompleteInputIsUnbalanced(t *testing.T) {
+	incomplete := []string{
+		"(+ 1",
+		"[1 2",
+		"{:a",
+		"((1)",
+		"(1 ; comment",
+		"(1 ; comment\n 2",
+		"(str \"a",
+		"\"abc",
+		"\"abc\\\"",
+		"(1 '",
+		"'",
+		"@ ; comment",
+	}
+	for _, input := range incomplete {
+		if _, err := ReadStr(input); !errors.Is(err, ErrUnbalanced) {
+			t.Errorf("%q: %v does not match ErrUnbalanced", input, err)
+		}
+	}
+	complete := []string{"", "; comment", ")", "(1 :a:)", "(1 :a:", "(+ 1)", "\"a\"", "\"a\\\\\""}
+	for _, input := range complete {
+		if _, err := ReadStr(input); errors.Is(err, ErrUnbalanced) {
+			t.Errorf("%q: %v matches ErrUnbalanced", input, err)
+		}
+	}
+}
+
+func TestIntegerOptions(t *testing.T) {
+	tests := []struct {
+		input    string
+		promote  bool
+		expected string
+	}{
+		{"9223372036854775807", false, "types.Integer"},
+		{"9223372036854775807", true, "types.Integer"},
+		{"-9223372036854775808", true, "types.Integer"},
+		{"9223372036854775808", true, "types.BigInt"},
+		{"-9223372036854775809", true, "types.BigInt"},
+		{"123456789012345678901234567890", true, "types.BigInt"},
+		{"9223372036854775808", false, "error"},
+	}
+	for _, test := range tests {
+		value, err := ReadStrWithOptions(test.input, Options{PromoteIntegers: test.promote})
+		actual := fmt.Sprintf("%T", value)
+		if err != nil {
+			actual = "error"
+		}
+		if actual != test.expected {
+			t.Errorf("%s with promotion %v read as %s, not %s", test.input, test.promote, actual, test.expected)
+			continue
+		}
+		if err == nil && printer.PrintStr(printer.Config{}, value) != test.input {
+			t.Errorf("%s read as %v", test.input, value)
+		}
+	}
+}
+
+func TestReadStream(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected []string
+	}{
+		{"", nil},
+		{"; only a comment\n", nil},
+		{"1 2 3", []string{"1", "2", "3"}},
+		{"(def! x 1)\n(+ x 1)\n", []string{"(def! x 1)", "(+ x 1)"}},
+		{"[1\n2] {:a\n1} ; trailing", []string{"[1 2]", "{:a 1}"}},
+		{"'a @b \"c d\" \\e", []string{"'a", "@b", `"c d"`, `\e`}},
+	}
+	for _, test := range tests {
+		reader := NewReader(strings.NewReader(test.input))
+		var actual []string
+		for {
+			value, err := reader.Read()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Errorf("%q: %v", test.input, err)
+				break
+			}
+			actual = append(actual, printer.PrintStr(printer.Config{Readably: true}, value))
+		}
+		if strings.Join(actual, " ") != strings.Join(test.expected, " ") || len(actual) != len(test.expected) {
+			t.Errorf("%q read as %v, not %v", test.input, actual, test.expected)
+		}
+	}
+}
+
+func TestReadStreamIncrementally(t *testing.T) {
+	r, w := io.Pipe()
+	reader := NewReader(r)
+	forms := []string{"(+ 1 2)", "[:a\n:b]", `"x"`}
+	for _, form := range forms {
+		// Each form is read before any later input exists
+		go io.WriteString(w, form+"\n")
+		value, err := reader.Read()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if actual := printer.PrintStr(printer.Config{Readably: true}, value); actual != strings.ReplaceAll(form, "\n", " ") {
+			t.Errorf("read %s, not %s", actual, form)
+		}
+	}
+	w.Close()
+	if _, err := reader.Read(); err != io.EOF {
+		t.Errorf("expected EOF after the last form, got %v", err)
+	}
+}
+
+func TestReadEvalOption(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{"#=(+ 1 2)", "(eval (+ 1 2))"},
+		{"[1 #=x]", "[1 (eval x)]"},
+		{"{:a (f #=(g))}", "{:a (f (eval (g)))}"},
+		{"'#=x", "'(eval x)"},
+		{"#=#=x", "(eval (eval x))"},
+	}
+	for _, test := range tests {
+		value, err := ReadStrWithOptions(test.input, Options{ReadEval: true})
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+		} else if actual := printer.PrintStr(printer.Config{Readably: true}, value); actual != test.expected {
+			t.Errorf("%s read as %s, not %s", test.input, actual, test.expected)
+		}
+		if _, err := ReadStr(test.input); !errors.Is(err, ErrReadEval) {
+			t.Errorf("%s: read without the option as %v", test.input, err)
+		}
+		reader := NewReaderWithOptions(strings.NewReader("1 "+test.input), Options{ReadEval: true})
+		if _, err := reader.Read(); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := reader.Read(); err != nil {
+			t.Errorf("%s: streamed with the option as %v", test.input, err)
+		}
+	}
+}
+
+func TestKeywords(t *testing.T) {
+	tests := []struct {
+		input    string
+		expected string
+	}{
+		{":a", ":a"},
+		{":foo-bar?", ":foo-bar?"},
+		{":foo/bar", ":foo/bar"},
+		{":a.b", ":a.b"},
+		{":1", ":1"},
+		{"[:a :b]", "[:a :b]"},
+		{":", "error: Invalid keyword: keywords require a name"},
+		{"::foo", "error: Invalid keyword: auto-resolved keywords are not supported: ::foo"},
+		{"::", "error: Invalid keyword: auto-resolved keywords are not supported: ::"},
+		{":a:", "error: Invalid keyword: :a:"},
+		{"[:a :]", "error: Invalid keyword: keywords require a name"},
+	}
+	for _, test := range tests {
+		value, err := ReadStr(test.input)
+		var actual string
+		if err != nil {
+			var readerErr Error
+			if !errors.As(err, &readerErr) {
+				t.Errorf("%s: %v is not a reader error", test.input, err)
+				continue
+			}
+			actual = "error: " + readerErr.Message
+		} else {
+			actual = printer.PrintStr(printer.Config{Readably: true}, value)
+		}
+		if actual != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.input, test.expected, actual)
+		}
+	}
+	value, err := ReadStr(":a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keyword, valid := value.(types.Keyword); !valid || !keyword.Identical(types.NewKeyword("a")) {
+		t.Errorf(":a read as %#v", value)
+	}
+}
+
+func TestPrefixCombinations(t *testing.T) {
+	wrap := func(name string, value types.MalType) types.MalType {
+		return types.NewList(types.NewSymbol(name), value)
+	}
+	x, a := types.NewSymbol("x"), types.NewSymbol("a")
+	tests := []struct {
+		input    string
+		expected types.MalType
+	}{
+		{"~@x", wrap("splice-unquote", x)},
+		{"~ @x", wrap("unquote", wrap("deref", x))},
+		{"~(deref x)", wrap("unquote", types.NewList(types.NewSymbol("deref"), x))},
+		{"'@a", wrap("quote", wrap("deref", a))},
+		{"@'a", wrap("deref", wrap("quote", a))},
+		{"`~x", wrap("quasiquote", wrap("unquote", x))},
+		{"`~@x", wrap("quasiquote", wrap("splice-unquote", x))},
+		{"`(a ~@x)", wrap("quasiquote", types.NewList(a, wrap("splice-unquote", x)))},
+		{"''x", wrap("quote", wrap("quote", x))},
+		{"`'~x", wrap("quasiquote", wrap("quote", wrap("unquote", x)))},
+		{"@@a", wrap("deref", wrap("deref", a))},
+		{"~~x", wrap("unquote", wrap("unquote", x))},
+		{"'[~@x]", wrap("quote", types.NewVector(wrap("splice-unquote", x)))},
+		{"(~@x ~x)", types.NewList(wrap("splice-unquote", x), wrap("unquote", x))},
+	}
+	for _, test := range tests {
+		value, err := ReadStr(test.input)
+		if err != nil {
+			t.Errorf("%s: %v", test.input, err)
+			continue
+		}
+		if !types.Equals(value, test.expected) {
+			t.Errorf("%s read as %v, not %v", test.input, value, test.expected)
+		}
+	}
+}
@@ -3,15 +3,41 @@ package runtime
 import (
 	"errors"
 
+	"github.com/benbjohnson/immutable"
 	"github.com/dball/glimpse/ex"
 	"github.com/dball/glimpse/types"
 )
 
 var (
-	invalidType  = ex.Ex{Code: "Invalid type"}
-	invalidValue = ex.Ex{Code: "Invalid value"}
+	// ErrInvalidType matches errors from values of an unsupported type
+	ErrInvalidType = ex.Ex{Code: "Invalid type"}
+	// ErrInvalidValue matches errors from values out of a supported range
+	ErrInvalidValue = ex.Ex{Code: "Invalid value"}
 )
 
+// ProgressInterval is the number of items traversed between progress calls
+const ProgressInterval = 10000
+
+// Progress reports to the hook, if any, that a traversal has reached the
+// given count of items, once every ProgressInterval items
+func Progress(hook func(count int), count int) {
+	if hook != nil && count > 0 && count%ProgressInterval == 0 {
+		hook(count)
+	}
+}
+
+// Truthy returns false for false and nil values, true for all others
+func Truthy(value types.MalType) bool {
+	switch value {
+	case types.Boolean(false):
+		return false
+	case types.Nil{}:
+		return false
+	default:
+		return true
+	}
+}
+
 // Seq returns a seq for seq or seqable values
 func Seq(value types.MalType) (types.Seq, error) {
 	var seq types.Seq
@@ -21,7 +47,7 @@ func Seq(value types.MalType) (types.Seq, error) {
 	case types.Seqable:
 		seq = tvalue.Seq()
 	default:
-		return nil, invalidType
+		return nil, ErrInvalidType
 	}
 	empty, _, _ := seq.Next()
 	if empty {
@@ -44,11 +70,11 @@ func Empty(value types.MalType) (types.Boolean, error) {
 func TakeDrop(n types.MalType, value types.MalType) (types.SliceSeq, types.Seq, error) {
 	intN, valid := n.(types.Integer)
 	if !valid {
-		return types.SliceSeq{}, nil, invalidType
+		return types.SliceSeq{}, nil, ErrInvalidType
 	}
 	in := int64(intN)
 	if in < 0 {
-		return types.SliceSeq{}, nil, invalidValue
+		return types.SliceSeq{}, nil, ErrInvalidValue
 	}
 	seq, err := Seq(value)
 	if err != nil {
@@ -108,22 +134,53 @@ func Conj(coll types.MalType, values ...types.MalType) (types.Conjable, error) {
 	return conjable, nil
 }
 
-// Into pours a seqable into a collection
+// Into pours a seqable into a collection, conjoining each item as it is traversed
 func Into(coll types.MalType, value types.MalType) (types.Conjable, error) {
-	var values []types.MalType
+	return IntoWithProgress(coll, value, nil)
+}
+
+// IntoWithProgress pours a seqable into a collection, reporting progress to
+// the hook, if any
+func IntoWithProgress(coll types.MalType, value types.MalType, progress func(count int)) (types.Conjable, error) {
+	conjable, valid := coll.(types.Conjable)
+	if !valid {
+		return nil, errors.New("Invalid conj target")
+	}
 	seq, err := Seq(value)
 	if err != nil {
 		return nil, err
 	}
-	for {
+	if vector, valid := coll.(types.Vector); valid {
+		return intoVector(vector, seq, progress), nil
+	}
+	for count := 1; ; count++ {
 		empty, head, tail := seq.Next()
 		if empty {
-			break
+			return conjable, nil
 		}
-		values = append(values, head)
+		newconj, err := conjable.Conj(head)
+		if err != nil {
+			return nil, err
+		}
+		conjable = newconj
 		seq = tail
+		Progress(progress, count)
+	}
+}
+
+// intoVector appends the items of a seq to a vector with a builder, which
+// mutates a single copy of the vector rather than copying it for each item
+func intoVector(vector types.Vector, seq types.Seq, progress func(count int)) types.Vector {
+	b := immutable.NewListBuilder(vector.Imm)
+	for count := 1; ; count++ {
+		empty, head, tail := seq.Next()
+		if empty {
+			return types.Vector{Imm: b.List()}
+		}
+		b.Append(head)
+		seq = tail
+		Progress(progress, count)
 	}
-	return Conj(coll, values...)
 }
 
 // IntoEmptyVector is a convenience fn
@@ -134,6 +191,12 @@ func IntoEmptyVector(value types.MalType) types.Vector {
 
 // IntoSlice pours a seq into a slice
 func IntoSlice(value types.MalType) ([]types.MalType, error) {
+	return IntoSliceWithProgress(value, nil)
+}
+
+// IntoSliceWithProgress pours a seq into a slice, reporting progress to the
+// hook, if any
+func IntoSliceWithProgress(value types.MalType, progress func(count int)) ([]types.MalType, error) {
 	var values []types.MalType
 	seq, err := Seq(value)
 	if err != nil {
@@ -146,6 +209,7 @@ func IntoSlice(value types.MalType) ([]types.MalType, error) {
 		}
 		values = append(values, head)
 		seq = tail
+		Progress(progress, len(values))
 	}
 	return values, nil
 }
@@ -158,17 +222,17 @@ func Nth(value types.MalType, n types.MalType) (types.MalType, error) {
 	}
 	nint, valid := n.(types.Integer)
 	if !valid {
-		return err, invalidValue
+		return err, ErrInvalidValue
 	}
 	nint64 := int64(nint)
 	if nint64 < 0 {
-		return nil, invalidValue
+		return nil, ErrInvalidValue
 	}
 	var i int64
 	for {
 		empty, head, tail := seq.Next()
 		if empty {
-			return nil, invalidValue
+			return nil, ErrInvalidValue
 		}
 		if i == nint64 {
 			return head, nil
@@ -178,6 +242,23 @@ func Nth(value types.MalType, n types.MalType) (types.MalType, error) {
 	}
 }
 
+// Last returns the final value in a seqable, or nil if it is empty
+func Last(value types.MalType) (types.MalType, error) {
+	seq, err := Seq(value)
+	if err != nil {
+		return nil, err
+	}
+	var last types.MalType = types.Nil{}
+	for {
+		empty, head, tail := seq.Next()
+		if empty {
+			return last, nil
+		}
+		last = head
+		seq = tail
+	}
+}
+
 // Get looks up a key in an indexed collection
 func Get(coll types.MalType, index types.MalType, notfound types.MalType) types.MalType {
 	indexed, valid := coll.(types.Indexed)
@@ -191,6 +272,63 @@ func Get(coll types.MalType, index types.MalType, notfound types.MalType) types.
 	return value
 }
 
+// GetIn looks up a path of keys through nested indexed collections
+func GetIn(coll types.MalType, path types.MalType, notfound types.MalType) (types.MalType, error) {
+	seq, err := Seq(path)
+	if err != nil {
+		return nil, err
+	}
+	for {
+		empty, head, tail := seq.Next()
+		if empty {
+			return coll, nil
+		}
+		indexed, valid := coll.(types.Indexed)
+		if !valid {
+			return notfound, nil
+		}
+		value, found := indexed.Lookup(head)
+		if !found {
+			return notfound, nil
+		}
+		coll = value
+		seq = tail
+	}
+}
+
+// AssocIn sets a value at a path of keys through nested maps, creating
+// intermediate maps where the path is missing or nil
+func AssocIn(coll types.MalType, path types.MalType, value types.MalType) (types.MalType, error) {
+	keys, err := IntoSlice(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(keys) == 0 {
+		return nil, ErrInvalidValue
+	}
+	return assocIn(coll, keys, value)
+}
+
+func assocIn(coll types.MalType, keys []types.MalType, value types.MalType) (types.MalType, error) {
+	var m types.Map
+	switch v := coll.(type) {
+	case types.Map:
+		m = v
+	case types.Nil:
+		m = types.NewMap()
+	default:
+		return nil, ErrInvalidType
+	}
+	if len(keys) > 1 {
+		inner, err := assocIn(Get(m, keys[0], types.Nil{}), keys[1:], value)
+		if err != nil {
+			return nil, err
+		}
+		value = inner
+	}
+	return m.Assoc(keys[0], value), nil
+}
+
 // Contains tests the existence of a mapping for a key in an indexed collection
 func Contains(coll types.MalType, index types.MalType) types.Boolean {
 	indexed, valid := coll.(types.Indexed)
@@ -205,60 +343,50 @@ func Contains(coll types.MalType, index types.MalType) types.Boolean {
 func Keys(coll types.MalType) (types.List, error) {
 	m, valid := coll.(types.Map)
 	if !valid {
-		return types.NewList(), invalidType
-	}
-	imm := m.Imm
-	items := make([]types.MalType, imm.Len())
-	i := 0
-	itr := imm.Iterator()
-	for !itr.Done() {
-		k, _ := itr.Next()
-		items[i] = k
+		return types.NewList(), ErrInvalidType
 	}
-	return types.NewList(items...), nil
+	keys, _ := m.Entries()
+	return types.NewList(keys...), nil
 }
 
-// Vals returns a list of keys in a map
+// Vals returns a list of values in a map
 func Vals(coll types.MalType) (types.List, error) {
 	m, valid := coll.(types.Map)
 	if !valid {
-		return types.NewList(), invalidType
+		return types.NewList(), ErrInvalidType
 	}
-	imm := m.Imm
-	items := make([]types.MalType, imm.Len())
-	i := 0
-	itr := imm.Iterator()
-	for !itr.Done() {
-		_, v := itr.Next()
-		items[i] = v
-	}
-	return types.NewList(items...), nil
+	_, vals := m.Entries()
+	return types.NewList(vals...), nil
 }
 
 // WithMeta adds metadata to a container
 func WithMeta(container types.MalType, metadata types.MalType) (types.MalType, error) {
 	hm, valid := container.(types.HasMetadata)
 	if !valid {
-		return nil, invalidType
+		return nil, ErrInvalidType
 	}
 	md, valid := metadata.(types.Map)
 	if !valid {
-		return nil, invalidType
+		return nil, ErrInvalidType
 	}
 	return hm.WithMetadata(md), nil
 }
 
-// Meta returns a container's metadata
+// Meta returns a container's or an atom's metadata
 func Meta(container types.MalType) (types.MalType, error) {
-	hm, valid := container.(types.HasMetadata)
-	if !valid {
-		return nil, invalidType
+	var md types.Map
+	switch v := container.(type) {
+	case types.HasMetadata:
+		md = v.Metadata()
+	case *types.Atom:
+		md = v.Metadata()
+	default:
+		return nil, ErrInvalidType
 	}
-	md := hm.Metadata()
 	if md.Imm == nil {
 		return types.Nil{}, nil
 	}
-	return hm.Metadata(), nil
+	return md, nil
 }
 
 func Range(constraints ...types.MalType) (types.MalType, error) {
@@ -266,7 +394,7 @@ func Range(constraints ...types.MalType) (types.MalType, error) {
 	for i, constraint := range constraints {
 		in, valid := constraint.(types.Integer)
 		if !valid {
-			return nil, invalidType
+			return nil, ErrInvalidType
 		}
 		ints[i] = int64(in)
 	}
@@ -280,6 +408,64 @@ func Range(constraints ...types.MalType) (types.MalType, error) {
 	case 3:
 		return types.Range{Lower: ints[0], Upper: ints[1], Step: ints[2], Finite: true}, nil
 	default:
-		return nil, invalidValue
+		return nil, ErrInvalidValue
+	}
+}
+
+// Type returns a keyword naming the type of a value
+func Type(value types.MalType) types.Keyword {
+	var name string
+	switch v := value.(type) {
+	case types.Nil:
+		name = "nil"
+	case types.Boolean:
+		name = "boolean"
+	case types.Integer:
+		name = "integer"
+	case types.BigInt:
+		name = "bigint"
+	case types.String:
+		name = "string"
+	case types.Rune:
+		name = "char"
+	case types.Keyword:
+		name = "keyword"
+	case types.Symbol:
+		name = "symbol"
+	case types.List:
+		name = "list"
+	case types.Vector:
+		name = "vector"
+	case types.Map:
+		name = "map"
+	case types.Queue:
+		name = "queue"
+	case types.Function:
+		if v.IsMacro {
+			name = "macro"
+		} else {
+			name = "fn"
+		}
+	case *types.Atom:
+		name = "atom"
+	case *types.Promise:
+		name = "promise"
+	case *types.Delay:
+		name = "delay"
+	case *types.Future:
+		name = "future"
+	case *types.Volatile:
+		name = "volatile"
+	case *types.StringBuilder:
+		name = "string-builder"
+	case *types.MutableArray:
+		name = "array"
+	case types.Seq:
+		name = "seq"
+	case error:
+		name = "error"
+	default:
+		name = "unknown"
 	}
+	return types.NewKeyword(name)
 }
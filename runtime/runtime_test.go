@@ -0,0 +1,123 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dball/glimpse/ex"
+	"github.com/dball/glimpse/types"
+)
+
+func TestErrorsMatchSentinels(t *testing.T) {
+	_, err := Seq(types.Integer(1))
+	if !errors.Is(err, ErrInvalidType) {
+		t.Errorf("seq error %v does not match ErrInvalidType", err)
+	}
+	if errors.Is(err, ErrInvalidValue) {
+		t.Errorf("seq error %v matches ErrInvalidValue", err)
+	}
+	_, err = Nth(types.NewVector(types.Integer(1)), types.Integer(5))
+	wrapped := fmt.Errorf("evaluating: %w", err)
+	if !errors.Is(wrapped, ErrInvalidValue) {
+		t.Errorf("wrapped nth error %v does not match ErrInvalidValue", wrapped)
+	}
+	var e ex.Ex
+	if !errors.As(wrapped, &e) {
+		t.Fatalf("wrapped nth error %v is not an ex", wrapped)
+	}
+	if e.Code != ErrInvalidValue.Code {
+		t.Errorf("extracted ex has code %s", e.Code)
+	}
+	detailed := ex.Ex{Code: ErrInvalidType.Code, Context: map[string]interface{}{"value": types.Integer(1)}}
+	if !errors.Is(detailed, ErrInvalidType) {
+		t.Error("an ex with context does not match its code's sentinel")
+	}
+}
+
+// intoAllocs counts the allocations of pouring a range of n items into a vector
+func intoAllocs(n int64) float64 {
+	r := types.Range{Upper: n, Step: 1, Finite: true}
+	return testing.AllocsPerRun(5, func() {
+		Into(types.NewVector(), r)
+	})
+}
+
+func TestIntoVectorAllocatesLinearly(t *testing.T) {
+	small, large := intoAllocs(1000), intoAllocs(10000)
+	// Copying the vector for each item would allocate quadratically
+	if ratio := large / small; ratio > 12 {
+		t.Errorf("10x the items took %.1fx the allocations", ratio)
+	}
+	v, err := Into(types.NewVector(types.Integer(-1)), types.Range{Upper: 3, Step: 1, Finite: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := types.NewVector(types.Integer(-1), types.Integer(0), types.Integer(1), types.Integer(2))
+	if !types.Equals(v, expected) {
+		t.Errorf("into a vector built %v", v)
+	}
+}
+
+func BenchmarkIntoVector(b *testing.B) {
+	r := types.Range{Upper: 100000, Step: 1, Finite: true}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		if _, err := Into(types.NewVector(), r); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func TestIntoMatchesConj(t *testing.T) {
+	items := []types.MalType{types.Integer(1), types.Integer(2), types.Integer(3)}
+	tests := []struct {
+		name   string
+		target types.MalType
+		source types.MalType
+	}{
+		{"list", types.NewList(types.Integer(0)), types.NewVector(items...)},
+		{"vector", types.NewVector(types.Integer(0)), types.NewList(items...)},
+		{"empty vector", types.NewVector(), types.Range{Upper: 3, Step: 1, Finite: true}},
+		{"queue", types.NewQueue(types.Integer(0)), types.NewList(items...)},
+		{"empty source", types.NewVector(types.Integer(0)), types.NewList()},
+	}
+	for _, test := range tests {
+		source, err := IntoSlice(test.source)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected, err := Conj(test.target, source...)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual, err := Into(test.target, test.source)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !types.Equals(actual, expected) {
+			t.Errorf("%s: into built %v, conj built %v", test.name, actual, expected)
+		}
+	}
+	if _, err := Into(types.Integer(1), types.NewList()); err == nil {
+		t.Error("poured into an integer")
+	}
+}
+
+// intoListAllocs counts the allocations of pouring a range of n items into a list
+func intoListAllocs(n int64) float64 {
+	r := types.Range{Upper: n, Step: 1, Finite: true}
+	return testing.AllocsPerRun(5, func() {
+		Into(types.NewList(), r)
+	})
+}
+
+func TestIntoListAllocatesPerItem(t *testing.T) {
+	small, large := intoListAllocs(1000), intoListAllocs(10000)
+	// Conjoining from the seq allocates a constant amount per item, with no
+	// intermediate slice of every item
+	if ratio := large / small; ratio > 12 {
+		t.Errorf("10x the items took %.1fx the allocations", ratio)
+	}
+}
@@ -0,0 +1,47 @@
+package types
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// MutableArray - a fixed-size array whose elements may be set in place
+type MutableArray struct {
+	Items []MalType
+}
+
+// NewMutableArray builds a new array of n nils
+func NewMutableArray(n int) *MutableArray {
+	items := make([]MalType, n)
+	for i := range items {
+		items[i] = Nil{}
+	}
+	return &MutableArray{Items: items}
+}
+
+// Count counts the elements of an array
+func (a *MutableArray) Count() int {
+	return len(a.Items)
+}
+
+// Seq of an array traverses a snapshot of its current elements
+func (a *MutableArray) Seq() Seq {
+	items := make([]MalType, len(a.Items))
+	copy(items, a.Items)
+	return buildSeqFromSlice(items)
+}
+
+// ValueEquals checks pointer equality
+func (a *MutableArray) ValueEquals(that MalType) bool {
+	thatArray, valid := that.(*MutableArray)
+	if !valid {
+		return false
+	}
+	return a == thatArray
+}
+
+func (a *MutableArray) hashBytes() []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(uintptr(unsafe.Pointer(a))))
+	return b[:]
+}
@@ -2,17 +2,55 @@ package types
 
 import (
 	"encoding/binary"
+	"sync"
 	"unsafe"
 )
 
 // Atom - mal atom values
 type Atom struct {
 	Value MalType
+	Meta  Map
+	mu    sync.Mutex
+	// version counts the values set, so swaps can detect intervening sets
+	version uint64
 }
 
 // Set the value of an atom
 func (a *Atom) Set(value MalType) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
 	a.Value = value
+	a.version++
+}
+
+// Swap sets the value of an atom to the result of a fn of its current value,
+// returning the old and new values. The fn runs without the atom's lock, so it
+// may deref the atom, and is retried if another set intervenes.
+func (a *Atom) Swap(f func(MalType) (MalType, error)) (MalType, MalType, error) {
+	for {
+		a.mu.Lock()
+		old, version := a.Value, a.version
+		a.mu.Unlock()
+		value, err := f(old)
+		if err != nil {
+			return nil, nil, err
+		}
+		a.mu.Lock()
+		if a.version == version {
+			a.Value = value
+			a.version++
+			a.mu.Unlock()
+			return old, value, nil
+		}
+		a.mu.Unlock()
+	}
+}
+
+// Deref returns the current value of an atom
+func (a *Atom) Deref() (MalType, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.Value, nil
 }
 
 // ValueEquals checks pointer equality
@@ -32,3 +70,32 @@ func (a *Atom) hashBytes() []byte {
 	binary.LittleEndian.PutUint64(b, ui)
 	return b[:]
 }
+
+// Metadata for an atom. Atoms are references, so they do not implement
+// HasMetadata: their metadata is changed in place with ResetMeta and AlterMeta
+// rather than by deriving a new atom.
+func (a *Atom) Metadata() Map {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.Meta
+}
+
+// ResetMeta sets the metadata of an atom
+func (a *Atom) ResetMeta(m Map) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.Meta = m
+}
+
+// AlterMeta sets the metadata of an atom to the result of a fn of its current
+// metadata, holding the atom's lock throughout
+func (a *Atom) AlterMeta(f func(Map) (Map, error)) (Map, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	m, err := f(a.Meta)
+	if err != nil {
+		return Map{}, err
+	}
+	a.Meta = m
+	return m, nil
+}
@@ -0,0 +1,100 @@
+package types
+
+import (
+	"errors"
+	"sync"
+	"testing"
+)
+
+func TestAtomMetadata(t *testing.T) {
+	var a MalType = &Atom{Value: Integer(1)}
+	if _, valid := a.(HasMetadata); valid {
+		t.Fatal("atoms must not derive copies with metadata")
+	}
+	atom := a.(*Atom)
+	if atom.Metadata().Imm != nil {
+		t.Error("new atom has metadata")
+	}
+	md := NewMap(NewKeyword("x"), Integer(1))
+	atom.ResetMeta(md)
+	if !Equals(atom.Metadata(), md) {
+		t.Errorf("reset metadata reads back as %v", atom.Metadata())
+	}
+	altered, err := atom.AlterMeta(func(m Map) (Map, error) {
+		return m.Assoc(NewKeyword("y"), Integer(2)), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := NewMap(NewKeyword("x"), Integer(1), NewKeyword("y"), Integer(2))
+	if !Equals(altered, expected) || !Equals(atom.Metadata(), expected) {
+		t.Errorf("altered metadata reads back as %v", atom.Metadata())
+	}
+	failure := errors.New("failure")
+	if _, err := atom.AlterMeta(func(m Map) (Map, error) { return Map{}, failure }); err != failure {
+		t.Errorf("failed alter returned %v", err)
+	}
+	if !Equals(atom.Metadata(), expected) {
+		t.Error("failed alter changed the metadata")
+	}
+}
+
+func TestAtomAlterMetaConcurrently(t *testing.T) {
+	atom := &Atom{Value: Nil{}}
+	atom.ResetMeta(NewMap(NewKeyword("n"), Integer(0)))
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			atom.AlterMeta(func(m Map) (Map, error) {
+				n, _ := m.Lookup(NewKeyword("n"))
+				return m.Assoc(NewKeyword("n"), n.(Integer)+1), nil
+			})
+		}()
+	}
+	wg.Wait()
+	if n, _ := atom.Metadata().Lookup(NewKeyword("n")); n != Integer(100) {
+		t.Errorf("concurrent alters counted %v", n)
+	}
+}
+
+func TestAtomSwapConcurrently(t *testing.T) {
+	atom := &Atom{Value: Integer(0)}
+	var wg sync.WaitGroup
+	for i := 0; i < 100; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 10; j++ {
+				atom.Swap(func(v MalType) (MalType, error) { return v.(Integer) + 1, nil })
+			}
+		}()
+	}
+	wg.Wait()
+	if value, _ := atom.Deref(); value != Integer(1000) {
+		t.Errorf("concurrent swaps counted %v", value)
+	}
+}
+
+func TestAtomSwapRetriesAfterIntervening(t *testing.T) {
+	atom := &Atom{Value: Integer(1)}
+	var calls int
+	old, value, err := atom.Swap(func(v MalType) (MalType, error) {
+		calls++
+		if calls == 1 {
+			atom.Set(Integer(10))
+		}
+		return v.(Integer) + 1, nil
+	})
+	if err != nil || old != Integer(10) || value != Integer(11) || calls != 2 {
+		t.Errorf("swap returned %v, %v, %v after %d calls", old, value, err, calls)
+	}
+	failure := errors.New("failure")
+	if _, _, err := atom.Swap(func(MalType) (MalType, error) { return nil, failure }); err != failure {
+		t.Errorf("failed swap returned %v", err)
+	}
+	if value, _ := atom.Deref(); value != Integer(11) {
+		t.Errorf("failed swap changed the value to %v", value)
+	}
+}
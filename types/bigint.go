@@ -0,0 +1,42 @@
+package types
+
+import "math/big"
+
+// BigInt - mal integer values beyond the range of Integer
+type BigInt struct {
+	Int *big.Int
+}
+
+// NewInteger returns an Integer if the big integer is in its range, and a
+// BigInt otherwise, so equal integers always have the same type
+func NewInteger(i *big.Int) MalType {
+	if i.IsInt64() {
+		return Integer(i.Int64())
+	}
+	return BigInt{Int: i}
+}
+
+// ValueEquals compares big integers
+func (i BigInt) ValueEquals(that MalType) bool {
+	thatInt, valid := that.(BigInt)
+	if !valid {
+		return false
+	}
+	return i.Int.Cmp(thatInt.Int) == 0
+}
+
+func (i BigInt) hashBytes() []byte {
+	return append(i.Int.Bytes(), byte(i.Int.Sign()+1), byte('N'))
+}
+
+// AsBigInt returns an integer value as a big integer
+func AsBigInt(value MalType) (*big.Int, bool) {
+	switch v := value.(type) {
+	case Integer:
+		return big.NewInt(int64(v)), true
+	case BigInt:
+		return v.Int, true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,53 @@
+package types
+
+import (
+	"encoding/binary"
+	"sync"
+	"sync/atomic"
+	"unsafe"
+)
+
+// Delay - a value computed by a fn the first time it is dereferenced
+type Delay struct {
+	fn       func() (MalType, error)
+	once     sync.Once
+	value    MalType
+	err      error
+	realized uint32
+}
+
+// NewDelay builds a new unrealized delay of the given fn
+func NewDelay(fn func() (MalType, error)) *Delay {
+	return &Delay{fn: fn}
+}
+
+// Deref realizes the delay if necessary and returns its value, or the error
+// from realizing it
+func (d *Delay) Deref() (MalType, error) {
+	d.once.Do(func() {
+		d.value, d.err = d.fn()
+		d.fn = nil
+		atomic.StoreUint32(&d.realized, 1)
+	})
+	return d.value, d.err
+}
+
+// Realized is true if the delay has been dereferenced
+func (d *Delay) Realized() bool {
+	return atomic.LoadUint32(&d.realized) == 1
+}
+
+// ValueEquals checks pointer equality
+func (d *Delay) ValueEquals(that MalType) bool {
+	thatDelay, valid := that.(*Delay)
+	if !valid {
+		return false
+	}
+	return d == thatDelay
+}
+
+func (d *Delay) hashBytes() []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(uintptr(unsafe.Pointer(d))))
+	return b[:]
+}
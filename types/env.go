@@ -2,30 +2,48 @@ package types
 
 import (
 	"errors"
+	"sync"
 
 	"github.com/benbjohnson/immutable"
 )
 
-// Env binds names to values
+// Env binds names to values. Envs may be shared by futures, so their
+// bindings are read and replaced under a lock.
 type Env struct {
 	Outer    *Env
 	Bindings *immutable.Map
+	mu       sync.RWMutex
 }
 
 // Set sets the value of a symbol
 func (env *Env) Set(name string, value MalType) {
+	env.mu.Lock()
+	defer env.mu.Unlock()
 	env.Bindings = env.Bindings.Set(name, value)
 }
 
+// Lookup gets the value of a symbol bound in this env, ignoring outer envs
+func (env *Env) Lookup(name string) (MalType, bool) {
+	env.mu.RLock()
+	defer env.mu.RUnlock()
+	return env.Bindings.Get(name)
+}
+
+// SetFn sets the value of a symbol to a newly built fn, e.g. a builtin,
+// giving it an id
+func (env *Env) SetFn(name string, fn Function) {
+	fn.ID = NewFnID()
+	env.Set(name, fn)
+}
+
 // Get gets the value of a symbol
 func (env *Env) Get(name string) (MalType, error) {
-	value, found := env.Bindings.Get(name)
+	value, found := env.Lookup(name)
 	if !found {
 		if env.Outer == nil {
 			return nil, Undefined{Name: name}
 		}
-		outer := *env.Outer
-		return outer.Get(name)
+		return env.Outer.Get(name)
 	}
 	return value, nil
 }
@@ -38,31 +56,146 @@ func BuildEnv() *Env {
 // DeriveEnv derives an env
 func DeriveEnv(Outer *Env, binds, exprs []MalType) (*Env, error) {
 	env := BuildEnv()
+	Outer.mu.RLock()
 	env.Bindings = Outer.Bindings
+	Outer.mu.RUnlock()
 	env.Outer = Outer
-	var bindSymbols []Symbol
-	for _, bind := range binds {
-		bindSymbol, valid := bind.(Symbol)
-		if !valid {
-			return nil, errors.New("binds must be symbols")
-		}
-		bindSymbols = append(bindSymbols, bindSymbol)
-	}
-	varargs := len(bindSymbols) >= 2 && bindSymbols[len(bindSymbols)-2].Name == "&"
-	var varargSymbol Symbol
+	varargs := len(binds) >= 2 && Equals(binds[len(binds)-2], NewSymbol("&"))
+	var vararg MalType
 	if varargs {
-		varargSymbol = bindSymbols[len(bindSymbols)-1]
-		bindSymbols = bindSymbols[0 : len(bindSymbols)-2]
+		vararg = binds[len(binds)-1]
+		binds = binds[0 : len(binds)-2]
 	}
-	for i, bind := range bindSymbols {
+	for i, bind := range binds {
 		if i >= len(exprs) {
 			return nil, errors.New("no expr for bind")
 		}
-		env.Set(bind.Name, exprs[i])
+		if err := env.bind(bind, exprs[i]); err != nil {
+			return nil, err
+		}
 	}
 	if varargs {
-		list := NewList(exprs[len(bindSymbols):]...)
-		env.Set(varargSymbol.Name, list)
+		var rest []MalType
+		if len(exprs) > len(binds) {
+			rest = exprs[len(binds):]
+		}
+		if err := env.bind(vararg, NewList(rest...)); err != nil {
+			return nil, err
+		}
 	}
 	return env, nil
 }
+
+// bind sets the names in a binding form to the corresponding parts of a value.
+// Symbols bind the whole value, vectors destructure sequentially with optional
+// & rest and :as whole forms, and maps destructure by key with {name key},
+// :keys, and :as forms.
+func (env *Env) bind(pattern MalType, value MalType) error {
+	switch p := pattern.(type) {
+	case Symbol:
+		env.Set(p.Name, value)
+		return nil
+	case Vector:
+		return env.bindVector(p, value)
+	case Map:
+		return env.bindMap(p, value)
+	default:
+		return errors.New("binds must be symbols, vectors, or maps")
+	}
+}
+
+func (env *Env) bindVector(pattern Vector, value MalType) error {
+	var seq Seq = Nil{}
+	switch v := value.(type) {
+	case Seq:
+		seq = v
+	case Seqable:
+		seq = v.Seq()
+	default:
+		return errors.New("vector binds require a seqable value")
+	}
+	n := pattern.Imm.Len()
+	for i := 0; i < n; i++ {
+		bind := pattern.Imm.Get(i)
+		switch {
+		case Equals(bind, NewSymbol("&")):
+			if i+1 >= n {
+				return errors.New("& requires a bind")
+			}
+			var rest []MalType
+			for {
+				empty, head, tail := seq.Next()
+				if empty {
+					break
+				}
+				rest = append(rest, head)
+				seq = tail
+			}
+			if err := env.bind(pattern.Imm.Get(i+1), NewList(rest...)); err != nil {
+				return err
+			}
+			i++
+		case Equals(bind, NewKeyword("as")):
+			if i+1 >= n {
+				return errors.New(":as requires a bind")
+			}
+			if err := env.bind(pattern.Imm.Get(i+1), value); err != nil {
+				return err
+			}
+			i++
+		default:
+			empty, head, tail := seq.Next()
+			if empty {
+				head = Nil{}
+			} else {
+				seq = tail
+			}
+			if err := env.bind(bind, head); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (env *Env) bindMap(pattern Map, value MalType) error {
+	indexed, valid := value.(Indexed)
+	if !valid {
+		return errors.New("map binds require an indexed value")
+	}
+	lookup := func(key MalType) MalType {
+		v, found := indexed.Lookup(key)
+		if !found {
+			return Nil{}
+		}
+		return v
+	}
+	keys, vals := pattern.Entries()
+	for i, k := range keys {
+		switch {
+		case Equals(k, NewKeyword("as")):
+			if err := env.bind(vals[i], value); err != nil {
+				return err
+			}
+		case Equals(k, NewKeyword("keys")):
+			names, valid := vals[i].(Vector)
+			if !valid {
+				return errors.New(":keys requires a vector of symbols")
+			}
+			itr := names.Imm.Iterator()
+			for !itr.Done() {
+				_, name := itr.Next()
+				symbol, valid := name.(Symbol)
+				if !valid {
+					return errors.New(":keys requires a vector of symbols")
+				}
+				env.Set(symbol.Name, lookup(NewKeyword(symbol.Name)))
+			}
+		default:
+			if err := env.bind(k, lookup(vals[i])); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,28 @@
+package types
+
+import "encoding/binary"
+
+// ExInfo - an error carrying a message and a map of data about its cause
+type ExInfo struct {
+	Message string
+	Data    Map
+}
+
+func (e ExInfo) Error() string {
+	return e.Message
+}
+
+// ValueEquals compares messages and data
+func (e ExInfo) ValueEquals(that MalType) bool {
+	thatEx, valid := that.(ExInfo)
+	if !valid {
+		return false
+	}
+	return e.Message == thatEx.Message && Equals(e.Data, thatEx.Data)
+}
+
+func (e ExInfo) hashBytes() []byte {
+	b := make([]byte, 4)
+	binary.LittleEndian.PutUint32(b, Hash(e.Data))
+	return append(append([]byte(e.Message), b...), byte('!'))
+}
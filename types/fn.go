@@ -1,5 +1,10 @@
 package types
 
+import (
+	"encoding/binary"
+	"sync/atomic"
+)
+
 // Function - functions of values to value
 type Function struct {
 	Fn      func(...MalType) (MalType, error)
@@ -8,6 +13,17 @@ type Function struct {
 	Env     *Env
 	IsMacro bool
 	Meta    Map
+	Name    string
+	// ID identifies the fn, and is shared by copies of it, e.g. with metadata
+	ID uint64
+}
+
+// fnIDs counts the fn ids assigned so far
+var fnIDs uint64
+
+// NewFnID returns an id for a newly constructed fn
+func NewFnID() uint64 {
+	return atomic.AddUint64(&fnIDs, 1)
 }
 
 // Metadata for a fn
@@ -17,5 +33,24 @@ func (fn Function) Metadata() Map {
 
 // WithMetadata for a fn
 func (fn Function) WithMetadata(m Map) HasMetadata {
-	return Function{Fn: fn.Fn, Body: fn.Body, Binds: fn.Binds, Env: fn.Env, IsMacro: fn.IsMacro, Meta: m}
+	return Function{Fn: fn.Fn, Body: fn.Body, Binds: fn.Binds, Env: fn.Env, IsMacro: fn.IsMacro, Meta: m, Name: fn.Name, ID: fn.ID}
+}
+
+// ValueEquals checks fn identity; metadata does not affect equality. Fns
+// without an id are equal to none.
+func (fn Function) ValueEquals(that MalType) bool {
+	thatFn, valid := that.(Function)
+	if !valid {
+		return false
+	}
+	return fn.ID != 0 && fn.ID == thatFn.ID && fn.IsMacro == thatFn.IsMacro
+}
+
+func (fn Function) hashBytes() []byte {
+	b := make([]byte, 9)
+	binary.LittleEndian.PutUint64(b, fn.ID)
+	if fn.IsMacro {
+		b[8] = byte(1)
+	}
+	return b[:]
 }
@@ -0,0 +1,61 @@
+package types
+
+import "testing"
+
+func TestFunctionIdentity(t *testing.T) {
+	constant := func(value MalType) Function {
+		return Function{
+			Fn: func(args ...MalType) (MalType, error) {
+				return value, nil
+			},
+			ID: NewFnID(),
+		}
+	}
+	f := constant(Integer(1))
+	g := constant(Integer(1))
+	withMeta := f.WithMetadata(NewMap(NewKeyword("doc"), String("one")))
+	macro := f
+	macro.IsMacro = true
+	tests := []struct {
+		name  string
+		a, b  MalType
+		equal bool
+	}{
+		{"itself", f, f, true},
+		{"a copy with metadata", f, withMeta, true},
+		{"a distinct fn of the same code", f, g, false},
+		{"the same fn as a macro", f, macro, false},
+		{"a fn without an id", Function{}, Function{}, false},
+	}
+	for _, test := range tests {
+		if equal := Equals(test.a, test.b); equal != test.equal {
+			t.Errorf("%s: Equals is %v", test.name, equal)
+		}
+		if test.equal && Hash(test.a) != Hash(test.b) {
+			t.Errorf("%s: equal fns hash differently", test.name)
+		}
+	}
+}
+
+func TestEnvSetFnIdentifiesFns(t *testing.T) {
+	env := BuildEnv()
+	env.SetFn("f", Function{})
+	f, err := env.Get("f")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.(Function).ID == 0 {
+		t.Error("bound fn has no id")
+	}
+	if !Equals(f, f) {
+		t.Error("bound fn does not equal itself")
+	}
+	env.Set("g", f)
+	g, err := env.Get("g")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !Equals(f, g) {
+		t.Error("rebound fn does not equal itself")
+	}
+}
@@ -0,0 +1,81 @@
+package types
+
+import (
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+)
+
+// FromGo converts Go values into mal values. Slices and arrays become
+// vectors, maps become maps, and integral numbers become integers. Floats
+// without an integral value are unsupported, as are other Go types.
+func FromGo(value interface{}) (MalType, error) {
+	switch v := value.(type) {
+	case nil:
+		return Nil{}, nil
+	case bool:
+		return Boolean(v), nil
+	case string:
+		return String(v), nil
+	case *big.Int:
+		return NewInteger(v), nil
+	case Integer, BigInt, String, Boolean, Nil, Keyword, Symbol, Rune, List, Vector, Map, Queue, Range,
+		Concatenation, ConsCell, SliceSeq, ListIteratorSeq, ExInfo, Function, *Atom, *Promise, *Delay,
+		*Future, *Volatile, *StringBuilder, *MutableArray:
+		return v, nil
+	}
+	rv := reflect.ValueOf(value)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return Integer(rv.Int()), nil
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		u := rv.Uint()
+		if u > math.MaxInt64 {
+			return BigInt{Int: new(big.Int).SetUint64(u)}, nil
+		}
+		return Integer(int64(u)), nil
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || f < math.MinInt64 || f >= math.MaxInt64 {
+			return nil, fmt.Errorf("unsupported non-integral number: %v", f)
+		}
+		return Integer(int64(f)), nil
+	case reflect.Slice, reflect.Array:
+		items := make([]MalType, rv.Len())
+		for i := range items {
+			item, err := FromGo(rv.Index(i).Interface())
+			if err != nil {
+				return nil, err
+			}
+			items[i] = item
+		}
+		return NewVector(items...), nil
+	case reflect.Map:
+		entries := make([]MalType, 0, 2*rv.Len())
+		itr := rv.MapRange()
+		for itr.Next() {
+			k, err := FromGo(itr.Key().Interface())
+			if err != nil {
+				return nil, err
+			}
+			v, err := FromGo(itr.Value().Interface())
+			if err != nil {
+				return nil, err
+			}
+			entries = append(entries, k, v)
+		}
+		// Go maps are unordered, so the map traverses in the order of its
+		// key hashes rather than the random order of its entries
+		m := NewMap(entries...)
+		m.Order = nil
+		return m, nil
+	case reflect.Ptr:
+		if rv.IsNil() {
+			return Nil{}, nil
+		}
+		return FromGo(rv.Elem().Interface())
+	default:
+		return nil, fmt.Errorf("unsupported Go type: %T", value)
+	}
+}
@@ -0,0 +1,69 @@
+package types
+
+import (
+	"math"
+	"math/big"
+	"testing"
+)
+
+func TestFromGo(t *testing.T) {
+	one, two := Integer(1), Integer(2)
+	tests := []struct {
+		name     string
+		value    interface{}
+		expected MalType
+	}{
+		{"nested map", map[string]interface{}{
+			"name":  "glimpse",
+			"tags":  []interface{}{"lisp", 1, []int{2}},
+			"meta":  map[string]interface{}{"ok": true, "none": nil},
+			"count": 2.0,
+		}, NewMap(
+			String("name"), String("glimpse"),
+			String("tags"), NewVector(String("lisp"), one, NewVector(two)),
+			String("meta"), NewMap(String("ok"), Boolean(true), String("none"), Nil{}),
+			String("count"), two,
+		)},
+		{"array", [2]int8{1, 2}, NewVector(one, two)},
+		{"pointer", &[]uint{1}, NewVector(one)},
+		{"nil pointer", (*int)(nil), Nil{}},
+		{"large unsigned", uint64(math.MaxUint64), BigInt{Int: new(big.Int).SetUint64(math.MaxUint64)}},
+		{"mal value", NewKeyword("k"), NewKeyword("k")},
+	}
+	for _, test := range tests {
+		actual, err := FromGo(test.value)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if !Equals(actual, test.expected) {
+			t.Errorf("%s: expected %v, got %v", test.name, test.expected, actual)
+		}
+	}
+}
+
+func TestFromGoOrdersMapsByHash(t *testing.T) {
+	value := map[string]int{"a": 1, "b": 2, "c": 3, "d": 4, "e": 5}
+	first, err := FromGo(value)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected, _ := first.(Map).Entries()
+	for i := 0; i < 10; i++ {
+		m, _ := FromGo(value)
+		keys, _ := m.(Map).Entries()
+		for j := range keys {
+			if !Equals(keys[j], expected[j]) {
+				t.Fatalf("converted map keys in order %v, then %v", expected, keys)
+			}
+		}
+	}
+}
+
+func TestFromGoRejectsUnsupportedValues(t *testing.T) {
+	for _, value := range []interface{}{1.5, make(chan int), struct{}{}, []interface{}{1, 0.5}} {
+		if _, err := FromGo(value); err == nil {
+			t.Errorf("converted %#v", value)
+		}
+	}
+}
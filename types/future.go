@@ -0,0 +1,61 @@
+package types
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// Future - a value computed by a fn on its own goroutine, blocking derefs
+// until it is done
+type Future struct {
+	value MalType
+	err   error
+	done  chan struct{}
+}
+
+// NewFuture starts computing the value of the given fn on a new goroutine
+func NewFuture(fn func() (MalType, error)) *Future {
+	f := &Future{done: make(chan struct{})}
+	go func() {
+		f.value, f.err = fn()
+		close(f.done)
+	}()
+	return f
+}
+
+// Deref blocks until the future is done and returns its value, or the error
+// from computing it
+func (f *Future) Deref() (MalType, error) {
+	<-f.done
+	return f.value, f.err
+}
+
+// Done is closed when the future's value has been computed
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// Realized is true if the future is done
+func (f *Future) Realized() bool {
+	select {
+	case <-f.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValueEquals checks pointer equality
+func (f *Future) ValueEquals(that MalType) bool {
+	thatFuture, valid := that.(*Future)
+	if !valid {
+		return false
+	}
+	return f == thatFuture
+}
+
+func (f *Future) hashBytes() []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(uintptr(unsafe.Pointer(f))))
+	return b[:]
+}
@@ -0,0 +1,40 @@
+package types
+
+import "sync"
+
+// maxInterned bounds the intern table, so programs building many distinct
+// names, e.g. with gensym, don't grow it without limit. Keywords and symbols
+// built once it is full are not interned, and compare by name.
+var maxInterned = 1 << 16
+
+// interned is the canonical name shared by the keywords and symbols built
+// with it, so equal names compare by identity
+type interned struct {
+	name string
+}
+
+var (
+	internMu sync.RWMutex
+	names    = make(map[string]*interned)
+)
+
+// intern returns the canonical name, or nil if the table is full
+func intern(name string) *interned {
+	internMu.RLock()
+	canonical, found := names[name]
+	internMu.RUnlock()
+	if found {
+		return canonical
+	}
+	internMu.Lock()
+	defer internMu.Unlock()
+	if canonical, found := names[name]; found {
+		return canonical
+	}
+	if len(names) >= maxInterned {
+		return nil
+	}
+	canonical = &interned{name: name}
+	names[name] = canonical
+	return canonical
+}
@@ -0,0 +1,213 @@
+package types
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// ErrNotSerializable is returned when marshaling values without a JSON form
+var ErrNotSerializable = errors.New("value is not serializable to JSON")
+
+// marshalSeq marshals a seq's items as a JSON array
+func marshalSeq(seq Seq) ([]byte, error) {
+	var buf bytes.Buffer
+	buf.WriteByte('[')
+	for i := 0; ; i++ {
+		empty, head, tail := seq.Next()
+		if empty {
+			break
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		b, err := json.Marshal(head)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(b)
+		seq = tail
+	}
+	buf.WriteByte(']')
+	return buf.Bytes(), nil
+}
+
+// emptyArray is the JSON form of empty and zero sequential values
+var emptyArray = []byte("[]")
+
+// MarshalJSON marshals a list as an array
+func (list List) MarshalJSON() ([]byte, error) {
+	if list.Imm == nil {
+		return emptyArray, nil
+	}
+	return marshalSeq(list.Seq())
+}
+
+// MarshalJSON marshals a vector as an array
+func (vector Vector) MarshalJSON() ([]byte, error) {
+	if vector.Imm == nil {
+		return emptyArray, nil
+	}
+	return marshalSeq(vector.Seq())
+}
+
+// MarshalJSON marshals a queue as an array from front to rear
+func (q Queue) MarshalJSON() ([]byte, error) {
+	if q.Front == nil || q.Rear == nil {
+		return emptyArray, nil
+	}
+	return marshalSeq(q.Seq())
+}
+
+// MarshalJSON marshals an array's current elements as an array
+func (a *MutableArray) MarshalJSON() ([]byte, error) {
+	return marshalSeq(a.Seq())
+}
+
+// MarshalJSON marshals a finite range as an array, and refuses to marshal an
+// infinite range
+func (r Range) MarshalJSON() ([]byte, error) {
+	if !r.Finite {
+		return nil, ErrNotSerializable
+	}
+	return marshalSeq(r)
+}
+
+// MarshalJSON marshals a concatenation as an array
+func (c Concatenation) MarshalJSON() ([]byte, error) {
+	if len(c.Seqs) == 0 {
+		return emptyArray, nil
+	}
+	return marshalSeq(c)
+}
+
+// MarshalJSON marshals a cons as an array
+func (c ConsCell) MarshalJSON() ([]byte, error) {
+	return marshalSeq(c)
+}
+
+// MarshalJSON marshals a slice seq as an array
+func (seq SliceSeq) MarshalJSON() ([]byte, error) {
+	return marshalSeq(seq)
+}
+
+// MarshalJSON marshals a list iterator seq as an array
+func (seq ListIteratorSeq) MarshalJSON() ([]byte, error) {
+	if seq.Imm == nil {
+		return emptyArray, nil
+	}
+	return marshalSeq(seq)
+}
+
+// MarshalJSON marshals a map as an object, which requires string or keyword keys
+func (m Map) MarshalJSON() ([]byte, error) {
+	if m.Imm == nil {
+		return []byte("{}"), nil
+	}
+	var buf bytes.Buffer
+	buf.WriteByte('{')
+	keys, vals := m.Entries()
+	for i, k := range keys {
+		v := vals[i]
+		var name string
+		switch key := k.(type) {
+		case String:
+			name = string(key)
+		case Keyword:
+			name = key.Name
+		default:
+			return nil, errors.New("JSON object keys must be strings or keywords")
+		}
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		kb, err := json.Marshal(name)
+		if err != nil {
+			return nil, err
+		}
+		vb, err := json.Marshal(v)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(kb)
+		buf.WriteByte(':')
+		buf.Write(vb)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// MarshalJSON marshals nil as null
+func (Nil) MarshalJSON() ([]byte, error) {
+	return []byte("null"), nil
+}
+
+// MarshalJSON marshals a keyword as its name
+func (keyword Keyword) MarshalJSON() ([]byte, error) {
+	return json.Marshal(keyword.Name)
+}
+
+// MarshalJSON marshals a symbol as its name
+func (symbol Symbol) MarshalJSON() ([]byte, error) {
+	return json.Marshal(symbol.Name)
+}
+
+// MarshalJSON marshals a rune as a string
+func (r Rune) MarshalJSON() ([]byte, error) {
+	return json.Marshal(string(r))
+}
+
+// MarshalJSON marshals a big integer as a number
+func (i BigInt) MarshalJSON() ([]byte, error) {
+	return i.Int.MarshalJSON()
+}
+
+// MarshalJSON refuses to marshal fns
+func (fn Function) MarshalJSON() ([]byte, error) {
+	return nil, ErrNotSerializable
+}
+
+// MarshalJSON refuses to marshal atoms
+func (a *Atom) MarshalJSON() ([]byte, error) {
+	return nil, ErrNotSerializable
+}
+
+// MarshalJSON refuses to marshal promises
+func (p *Promise) MarshalJSON() ([]byte, error) {
+	return nil, ErrNotSerializable
+}
+
+// MarshalJSON refuses to marshal delays, which may not be realized
+func (d *Delay) MarshalJSON() ([]byte, error) {
+	return nil, ErrNotSerializable
+}
+
+// MarshalJSON refuses to marshal futures, which may not be done
+func (f *Future) MarshalJSON() ([]byte, error) {
+	return nil, ErrNotSerializable
+}
+
+// MarshalJSON refuses to marshal volatiles
+func (v *Volatile) MarshalJSON() ([]byte, error) {
+	return nil, ErrNotSerializable
+}
+
+// MarshalJSON refuses to marshal string builders
+func (sb *StringBuilder) MarshalJSON() ([]byte, error) {
+	return nil, ErrNotSerializable
+}
+
+// MarshalJSON marshals an ex-info as an object of its message and data
+func (e ExInfo) MarshalJSON() ([]byte, error) {
+	return json.Marshal(NewMap(NewKeyword("message"), String(e.Message), NewKeyword("data"), e.Data))
+}
+
+// MarshalJSON marshals a thrown value as the value
+func (err MalError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(err.Reason)
+}
+
+// MarshalJSON refuses to marshal undefined symbol errors
+func (err Undefined) MarshalJSON() ([]byte, error) {
+	return nil, ErrNotSerializable
+}
@@ -0,0 +1,75 @@
+package types
+
+import (
+	"encoding/json"
+	"errors"
+	"math/big"
+	"testing"
+)
+
+func TestMarshalJSON(t *testing.T) {
+	one, two, three := Integer(1), Integer(2), Integer(3)
+	array := NewMutableArray(2)
+	array.Items[0] = one
+	queue, _ := NewQueue(one, two).Conj(three)
+	tests := []struct {
+		name     string
+		value    MalType
+		expected string
+	}{
+		{"nested", NewMap(
+			NewKeyword("a"), NewVector(one, NewList(two, String("x"))),
+			String("b"), NewMap(NewKeyword("c"), Nil{}, NewKeyword("d"), Boolean(true)),
+		), `{"a":[1,[2,"x"]],"b":{"c":null,"d":true}}`},
+		{"keyword and symbol values", NewVector(NewKeyword("k"), NewSymbol("s"), Rune('r')), `["k","s","r"]`},
+		{"big integer", BigInt{Int: new(big.Int).Lsh(big.NewInt(1), 70)}, `1180591620717411303424`},
+		{"zero map", Map{}, `{}`},
+		{"zero list", List{}, `[]`},
+		{"zero vector", Vector{}, `[]`},
+		{"zero queue", Queue{}, `[]`},
+		{"queue", queue, `[1,2,3]`},
+		{"finite range", Range{Lower: 0, Upper: 3, Step: 1, Finite: true}, `[0,1,2]`},
+		{"concatenation", Concatenation{Seqs: []Seq{NewList(one).Seq(), NewVector(two, three).Seq()}}, `[1,2,3]`},
+		{"empty concatenation", Concatenation{}, `[]`},
+		{"cons", ConsCell{Head: one, Tail: NewList(two).Seq()}, `[1,2]`},
+		{"slice seq", SliceSeq{Items: []MalType{one, two}}, `[1,2]`},
+		{"array", array, `[1,null]`},
+		{"ex-info", ExInfo{Message: "boom", Data: NewMap(NewKeyword("a"), one)}, `{"message":"boom","data":{"a":1}}`},
+		{"thrown value", MalError{Reason: NewVector(one)}, `[1]`},
+	}
+	for _, test := range tests {
+		b, err := json.Marshal(test.value)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if string(b) != test.expected {
+			t.Errorf("%s: expected %s, got %s", test.name, test.expected, b)
+		}
+	}
+}
+
+func TestMarshalJSONRefusesValues(t *testing.T) {
+	tests := []struct {
+		name  string
+		value MalType
+	}{
+		{"fn", Function{}},
+		{"atom", &Atom{Value: Integer(1)}},
+		{"promise", &Promise{}},
+		{"delay", &Delay{}},
+		{"future", &Future{}},
+		{"volatile", &Volatile{Value: Integer(1)}},
+		{"string builder", &StringBuilder{}},
+		{"infinite range", Range{Step: 1}},
+		{"nested fn", NewVector(Integer(1), Function{})},
+	}
+	for _, test := range tests {
+		if _, err := json.Marshal(test.value); !errors.Is(err, ErrNotSerializable) {
+			t.Errorf("%s: expected ErrNotSerializable, got %v", test.name, err)
+		}
+	}
+	if _, err := json.Marshal(NewMap(Integer(1), Integer(2))); err == nil {
+		t.Error("marshaled a map with an integer key")
+	}
+}
@@ -1,13 +1,31 @@
 package types
 
-// Keyword - mal keyword values
+// Keyword - mal keyword values. The name of a qualified keyword includes its
+// namespace, e.g. :foo/bar.
 type Keyword struct {
-	Name string
+	Name      string
+	Namespace string
+	interned  *interned
 }
 
-// NewKeyword builds a new keyword
+// NewKeyword builds a new keyword, qualified if its name has a namespace
 func NewKeyword(name string) Keyword {
-	return Keyword{Name: name}
+	return Keyword{Name: name, Namespace: namespace(name), interned: intern(name)}
+}
+
+// Identical is true if two keywords share an interned name
+func (keyword Keyword) Identical(that Keyword) bool {
+	return keyword.interned != nil && keyword.interned == that.interned
+}
+
+// Interned is true if the keyword's name is interned
+func (keyword Keyword) Interned() bool {
+	return keyword.interned != nil
+}
+
+// LocalName is the name of a keyword without its namespace
+func (keyword Keyword) LocalName() string {
+	return localName(keyword.Name, keyword.Namespace)
 }
 
 // ValueEquals compares keywords
@@ -16,7 +34,7 @@ func (keyword Keyword) ValueEquals(that MalType) bool {
 	if !valid {
 		return false
 	}
-	return keyword.Name == thatKeyword.Name
+	return keyword.Identical(thatKeyword) || keyword.Name == thatKeyword.Name
 }
 
 func (keyword Keyword) hashBytes() []byte {
@@ -0,0 +1,129 @@
+package types
+
+import (
+	"strconv"
+	"testing"
+)
+
+func TestKeywordEquality(t *testing.T) {
+	tests := []struct {
+		a, b             Keyword
+		equal, identical bool
+	}{
+		{NewKeyword("a"), NewKeyword("a"), true, true},
+		{NewKeyword("ns/a"), NewKeyword("ns/" + "a"), true, true},
+		{NewKeyword("a"), NewKeyword("b"), false, false},
+		{NewKeyword("ns/a"), NewKeyword("a"), false, false},
+		{NewKeyword("a"), Keyword{Name: "a"}, true, false},
+		{Keyword{Name: "a"}, Keyword{Name: "a"}, true, false},
+	}
+	for _, test := range tests {
+		if Equals(test.a, test.b) != test.equal {
+			t.Errorf("%v and %v: expected equal to be %v", test.a, test.b, test.equal)
+		}
+		if test.a.Identical(test.b) != test.identical {
+			t.Errorf("%v and %v: expected identical to be %v", test.a, test.b, test.identical)
+		}
+	}
+}
+
+func TestNamesAreInterned(t *testing.T) {
+	if !NewKeyword("interned").Interned() {
+		t.Fatal("keyword is not interned")
+	}
+	if NewKeyword("interned").interned != NewSymbol("interned").interned {
+		t.Error("keyword and symbol of one name do not share it")
+	}
+	if !NewSymbol("s").Identical(NewSymbol("s")) {
+		t.Error("symbols of one name are not identical")
+	}
+	withMeta := NewSymbol("s").WithMetadata(NewMap()).(Symbol)
+	if !withMeta.Identical(NewSymbol("s")) {
+		t.Error("symbol with metadata is not identical")
+	}
+}
+
+func TestInternTableIsBounded(t *testing.T) {
+	internMu.Lock()
+	max := maxInterned
+	maxInterned = len(names)
+	internMu.Unlock()
+	defer func() {
+		internMu.Lock()
+		maxInterned = max
+		internMu.Unlock()
+	}()
+	if !NewKeyword("interned").Interned() {
+		t.Error("existing name is not interned")
+	}
+	overflow := NewKeyword("beyond the intern table")
+	if overflow.Interned() {
+		t.Fatal("name beyond the bound is interned")
+	}
+	if !Equals(overflow, NewKeyword("beyond the intern table")) {
+		t.Error("uninterned keywords of one name are not equal")
+	}
+	if Hash(overflow) != Hash(Keyword{Name: "beyond the intern table"}) {
+		t.Error("uninterned keywords of one name hash differently")
+	}
+}
+
+// keywords builds n keywords from k distinct names, each built separately
+func keywords(n int, k int) []MalType {
+	values := make([]MalType, n)
+	for i := range values {
+		values[i] = NewKeyword("keyword-" + strconv.Itoa(i%k))
+	}
+	return values
+}
+
+func BenchmarkKeywordEquals(b *testing.B) {
+	values := keywords(1000, 10)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		equal := 0
+		for j := range values {
+			if Equals(values[j], values[j%10]) {
+				equal++
+			}
+		}
+		if equal != len(values) {
+			b.Fatalf("%d of %d keywords were equal", equal, len(values))
+		}
+	}
+}
+
+func BenchmarkUninternedKeywordEquals(b *testing.B) {
+	values := keywords(1000, 10)
+	for i, value := range values {
+		values[i] = Keyword{Name: value.(Keyword).Name}
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		equal := 0
+		for j := range values {
+			if Equals(values[j], values[j%10]) {
+				equal++
+			}
+		}
+		if equal != len(values) {
+			b.Fatalf("%d of %d keywords were equal", equal, len(values))
+		}
+	}
+}
+
+func BenchmarkKeywordLookup(b *testing.B) {
+	values := keywords(1000, 100)
+	m := NewMap()
+	for i := 0; i < 100; i++ {
+		m = m.Assoc(values[i], Integer(i))
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		for j := range values {
+			if _, found := m.Lookup(values[j]); !found {
+				b.Fatalf("%v not found", values[j])
+			}
+		}
+	}
+}
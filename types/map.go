@@ -1,36 +1,176 @@
 package types
 
-import "github.com/benbjohnson/immutable"
+import (
+	"fmt"
+	"sort"
 
-// Map is an immutable map
+	"github.com/benbjohnson/immutable"
+)
+
+// arrayMapThreshold is the most entries a map keeps in insertion order
+const arrayMapThreshold = 8
+
+// Map is an immutable map. Like an array map, a small map remembers the order
+// its keys were added and traverses in that order.
 type Map struct {
 	Imm  *immutable.Map
 	Meta *Map
+	// Order holds the keys in insertion order while the map has no more than
+	// arrayMapThreshold entries
+	Order *immutable.List
 }
 
 // NewMap builds a new map
 func NewMap(values ...MalType) Map {
 	imm := immutable.NewMap(hasher{})
-	if len(values) > 0 {
-		b := immutable.NewMapBuilder(imm)
+	if len(values) == 0 {
+		return Map{Imm: imm}
+	}
+	b := immutable.NewMapBuilder(imm)
+	for i := 0; i < len(values); i += 2 {
+		b.Set(values[i], values[i+1])
+	}
+	imm = b.Map()
+	var order *immutable.List
+	if imm.Len() <= arrayMapThreshold {
+		var keys []MalType
+	Keys:
 		for i := 0; i < len(values); i += 2 {
-			b.Set(values[i], values[i+1])
+			for _, k := range keys {
+				if Equals(k, values[i]) {
+					continue Keys
+				}
+			}
+			keys = append(keys, values[i])
 		}
-		imm = b.Map()
+		order = NewList(keys...).Imm
 	}
-	return Map{Imm: imm}
+	return Map{Imm: imm, Order: order}
 }
 
-// Seq traverses map entries
-func (m Map) Seq() Seq {
-	entries := make([]MalType, m.Imm.Len())
-	var i int64
+// ordered is true if the map knows the insertion order of its keys
+func (m Map) ordered() bool {
+	if m.Order == nil {
+		return m.Imm.Len() == 0
+	}
+	return m.Order.Len() == m.Imm.Len()
+}
+
+// Assoc returns a map with the key set to the value,
+// or the same map if the key is already set to an equal value
+func (m Map) Assoc(key MalType, value MalType) Map {
+	if current, found := m.Imm.Get(key); found && Equals(current, value) {
+		return m
+	}
+	imm := m.Imm.Set(key, value)
+	var order *immutable.List
+	if m.ordered() && imm.Len() <= arrayMapThreshold {
+		if imm.Len() > m.Imm.Len() {
+			order = m.Order
+			if order == nil {
+				order = immutable.NewList()
+			}
+			order = order.Append(key)
+		} else {
+			order = m.Order
+		}
+	}
+	return Map{Imm: imm, Meta: m.Meta, Order: order}
+}
+
+// Dissoc returns a map without the key
+func (m Map) Dissoc(key MalType) Map {
+	imm := m.Imm.Delete(key)
+	if imm.Len() == m.Imm.Len() {
+		return m
+	}
+	var order *immutable.List
+	if m.ordered() {
+		b := immutable.NewListBuilder(immutable.NewList())
+		itr := m.Order.Iterator()
+		for !itr.Done() {
+			_, k := itr.Next()
+			if !Equals(k, key) {
+				b.Append(k)
+			}
+		}
+		order = b.List()
+	}
+	return Map{Imm: imm, Meta: m.Meta, Order: order}
+}
+
+// Entries returns the keys and values of a map in a stable order: insertion
+// order for small maps, otherwise sorted by the hashes of the keys
+func (m Map) Entries() ([]MalType, []MalType) {
+	if m.Order == nil || !m.ordered() {
+		return m.hashedEntries()
+	}
+	n := m.Order.Len()
+	keys := make([]MalType, n)
+	vals := make([]MalType, n)
+	itr := m.Order.Iterator()
+	for !itr.Done() {
+		i, k := itr.Next()
+		keys[i] = k
+		vals[i], _ = m.Imm.Get(k)
+	}
+	return keys, vals
+}
+
+// hashedEntries returns the keys and values of a map sorted by the hashes of
+// the keys, then their printed forms, so equal maps traverse identically
+// regardless of insertion order
+func (m Map) hashedEntries() ([]MalType, []MalType) {
+	n := m.Imm.Len()
+	keys := make([]MalType, n)
+	vals := make([]MalType, n)
+	hashes := make([]uint32, n)
+	var i int
 	itr := m.Imm.Iterator()
 	for !itr.Done() {
 		k, v := itr.Next()
-		entries[i] = NewVector(k, v)
+		keys[i] = k
+		vals[i] = v
+		hashes[i] = Hash(k)
 		i++
 	}
+	sort.Stable(entrySorter{keys, vals, hashes})
+	return keys, vals
+}
+
+// PrintedForm renders a value readably, ordering map keys whose hashes
+// collide. The printer sets it, as types cannot depend on the printer.
+var PrintedForm = func(value MalType) string {
+	return fmt.Sprintf("%#v", value)
+}
+
+// entrySorter sorts map entries by their key hashes, then their printed forms
+type entrySorter struct {
+	keys   []MalType
+	vals   []MalType
+	hashes []uint32
+}
+
+func (s entrySorter) Len() int { return len(s.keys) }
+func (s entrySorter) Less(i, j int) bool {
+	if s.hashes[i] != s.hashes[j] {
+		return s.hashes[i] < s.hashes[j]
+	}
+	return PrintedForm(s.keys[i]) < PrintedForm(s.keys[j])
+}
+func (s entrySorter) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.vals[i], s.vals[j] = s.vals[j], s.vals[i]
+	s.hashes[i], s.hashes[j] = s.hashes[j], s.hashes[i]
+}
+
+// Seq traverses map entries
+func (m Map) Seq() Seq {
+	keys, vals := m.Entries()
+	entries := make([]MalType, len(keys))
+	for i, k := range keys {
+		entries[i] = NewVector(k, vals[i])
+	}
 	return buildSeqFromSlice(entries)
 }
 
@@ -46,10 +186,13 @@ func (m Map) Lookup(index MalType) (MalType, bool) {
 
 // Metadata for a map
 func (m Map) Metadata() Map {
+	if m.Meta == nil {
+		return Map{}
+	}
 	return *(m.Meta)
 }
 
 // WithMetadata for a map
 func (m Map) WithMetadata(md Map) HasMetadata {
-	return Map{Imm: m.Imm, Meta: &md}
+	return Map{Imm: m.Imm, Meta: &md, Order: m.Order}
 }
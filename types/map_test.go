@@ -0,0 +1,56 @@
+package types
+
+import "testing"
+
+func TestMapEntriesOrder(t *testing.T) {
+	// These strings' hashes collide, so only their printed forms order them
+	colliding := []MalType{String("pi19827"), String("tg71155")}
+	if Hash(colliding[0]) != Hash(colliding[1]) {
+		t.Fatal("expected colliding hashes")
+	}
+	var values []MalType
+	for i := 0; i < 2*arrayMapThreshold; i++ {
+		values = append(values, Integer(i))
+	}
+	values = append(values, colliding...)
+	forward := NewMap()
+	backward := NewMap()
+	for i := range values {
+		forward = forward.Assoc(values[i], Nil{})
+		backward = backward.Assoc(values[len(values)-1-i], Nil{})
+	}
+	forwardKeys, _ := forward.Entries()
+	backwardKeys, _ := backward.Entries()
+	if len(forwardKeys) != len(values) || len(backwardKeys) != len(values) {
+		t.Fatalf("maps have %d and %d keys", len(forwardKeys), len(backwardKeys))
+	}
+	var found []MalType
+	for i, k := range forwardKeys {
+		if !Equals(k, backwardKeys[i]) {
+			t.Fatalf("maps built in different orders traverse differently: %v, %v", forwardKeys, backwardKeys)
+		}
+		if s, valid := k.(String); valid {
+			found = append(found, s)
+		}
+	}
+	if len(found) != 2 || !Equals(found[0], colliding[0]) {
+		t.Errorf("colliding keys traverse as %v", found)
+	}
+}
+
+func TestSmallMapEntriesKeepInsertionOrder(t *testing.T) {
+	a, b, c := NewKeyword("a"), NewKeyword("b"), NewKeyword("c")
+	m := NewMap(c, Integer(1), a, Integer(2)).Assoc(b, Integer(3)).Assoc(c, Integer(4))
+	keys, vals := m.Entries()
+	expectedKeys := []MalType{c, a, b}
+	expectedVals := []MalType{Integer(4), Integer(2), Integer(3)}
+	for i := range expectedKeys {
+		if !Equals(keys[i], expectedKeys[i]) || !Equals(vals[i], expectedVals[i]) {
+			t.Fatalf("entries are %v %v", keys, vals)
+		}
+	}
+	keys, _ = m.Dissoc(a).Entries()
+	if len(keys) != 2 || !Equals(keys[0], c) || !Equals(keys[1], b) {
+		t.Errorf("entries after dissoc are %v", keys)
+	}
+}
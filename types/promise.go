@@ -0,0 +1,66 @@
+package types
+
+import (
+	"encoding/binary"
+	"sync"
+	"unsafe"
+)
+
+// Promise - a value which may be delivered once, blocking derefs until then
+type Promise struct {
+	value MalType
+	once  sync.Once
+	done  chan struct{}
+}
+
+// NewPromise builds a new undelivered promise
+func NewPromise() *Promise {
+	return &Promise{done: make(chan struct{})}
+}
+
+// Deliver sets the value of a promise, returning false if it was already delivered
+func (p *Promise) Deliver(value MalType) bool {
+	delivered := false
+	p.once.Do(func() {
+		p.value = value
+		delivered = true
+		close(p.done)
+	})
+	return delivered
+}
+
+// Deref blocks until the promise is delivered and returns its value
+func (p *Promise) Deref() (MalType, error) {
+	<-p.done
+	return p.value, nil
+}
+
+// Done is closed when the promise is delivered
+func (p *Promise) Done() <-chan struct{} {
+	return p.done
+}
+
+// Realized is true if the promise has been delivered
+func (p *Promise) Realized() bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+		return false
+	}
+}
+
+// ValueEquals checks pointer equality
+func (p *Promise) ValueEquals(that MalType) bool {
+	thatPromise, valid := that.(*Promise)
+	if !valid {
+		return false
+	}
+	return p == thatPromise
+}
+
+func (p *Promise) hashBytes() []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(uintptr(unsafe.Pointer(p))))
+	return b[:]
+}
@@ -0,0 +1,60 @@
+package types
+
+import "github.com/benbjohnson/immutable"
+
+// Queue - a persistent FIFO queue, which reads from the front list and
+// appends to the rear list, moving the rear to the front when it empties
+type Queue struct {
+	Front *immutable.List
+	Rear  *immutable.List
+}
+
+// NewQueue builds a new queue of the given items in order
+func NewQueue(items ...MalType) Queue {
+	return Queue{Front: NewList(items...).Imm, Rear: immutable.NewList()}
+}
+
+// Sequential queues
+func (Queue) Sequential() {}
+
+// Seq traverses queue items from front to rear
+func (q Queue) Seq() Seq {
+	if q.Rear.Len() == 0 {
+		return ListIteratorSeq{Imm: q.Front}
+	}
+	return Concatenation{Seqs: []Seq{ListIteratorSeq{Imm: q.Front}, ListIteratorSeq{Imm: q.Rear}}}
+}
+
+// Count counts queue items
+func (q Queue) Count() int {
+	return q.Front.Len() + q.Rear.Len()
+}
+
+// Conj enqueues at the rear
+func (q Queue) Conj(value MalType) (Conjable, error) {
+	if q.Front.Len() == 0 {
+		return Queue{Front: q.Front.Append(value), Rear: q.Rear}, nil
+	}
+	return Queue{Front: q.Front, Rear: q.Rear.Append(value)}, nil
+}
+
+// Peek returns the item at the front of the queue, if any
+func (q Queue) Peek() (MalType, bool) {
+	if q.Front.Len() == 0 {
+		return nil, false
+	}
+	return q.Front.Get(0), true
+}
+
+// Pop returns the queue without its front item
+func (q Queue) Pop() (Queue, bool) {
+	n := q.Front.Len()
+	switch n {
+	case 0:
+		return q, false
+	case 1:
+		return Queue{Front: q.Rear, Rear: immutable.NewList()}, true
+	default:
+		return Queue{Front: q.Front.Slice(1, n), Rear: q.Rear}, true
+	}
+}
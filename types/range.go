@@ -13,6 +13,9 @@ func (r Range) Seq() Seq {
 	return r
 }
 
+// Sequential marks ranges as ordered
+func (Range) Sequential() {}
+
 // Next of a range increments Lower unless it's finite and finished
 func (r Range) Next() (bool, MalType, Seq) {
 	if r.Finite && r.Lower >= r.Upper {
@@ -22,3 +25,31 @@ func (r Range) Next() (bool, MalType, Seq) {
 	tail := Range{Lower: r.Lower + r.Step, Upper: r.Upper, Step: r.Step, Finite: r.Finite}
 	return false, head, tail
 }
+
+// Unbounded is true if a seq never ends: an infinite range, or a cons or
+// concatenation ending in one
+func Unbounded(seq Seq) bool {
+	for {
+		switch s := seq.(type) {
+		case Range:
+			return !s.Finite
+		case ConsCell:
+			seq = s.Tail
+		case Concatenation:
+			for _, part := range s.Seqs {
+				if Unbounded(part) {
+					return true
+				}
+			}
+			return false
+		default:
+			return false
+		}
+	}
+}
+
+// infiniteRange returns the seq as an infinite range, if it is one
+func infiniteRange(seq Seq) (Range, bool) {
+	r, valid := seq.(Range)
+	return r, valid && !r.Finite
+}
@@ -13,5 +13,5 @@ func (r Rune) ValueEquals(that MalType) bool {
 }
 
 func (r Rune) hashBytes() []byte {
-	return []byte(string(r))
+	return append([]byte(string(r)), byte('\\'))
 }
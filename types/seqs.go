@@ -16,6 +16,14 @@ func (seq SliceSeq) Next() (bool, MalType, Seq) {
 	return false, seq.Items[0], SliceSeq{Items: seq.Items[1:]}
 }
 
+// Seq of a slice seq is itself
+func (seq SliceSeq) Seq() Seq {
+	return seq
+}
+
+// Sequential marks slice seqs as ordered
+func (SliceSeq) Sequential() {}
+
 // Count counts the items in a slice
 func (seq SliceSeq) Count() int {
 	return len(seq.Items)
@@ -55,6 +63,14 @@ func (seq ListIteratorSeq) Next() (bool, MalType, Seq) {
 	return false, head, tail
 }
 
+// Seq of a list iterator seq is itself
+func (seq ListIteratorSeq) Seq() Seq {
+	return seq
+}
+
+// Sequential marks list iterator seqs as ordered
+func (ListIteratorSeq) Sequential() {}
+
 // Metadata for a list
 func (seq ListIteratorSeq) Metadata() Map {
 	return seq.Meta
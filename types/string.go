@@ -1,5 +1,7 @@
 package types
 
+import "unicode/utf8"
+
 // String - mal string values
 type String string
 
@@ -12,8 +14,15 @@ func (s String) ValueEquals(that MalType) bool {
 	return s == thatString
 }
 
+// hashBytes ends with a type marker, like symbols and keywords, so values of
+// these types never collide even when their names match
 func (s String) hashBytes() []byte {
-	return []byte(s)
+	return append([]byte(s), byte('"'))
+}
+
+// Count of a string is its number of runes, consistent with its seq
+func (s String) Count() int {
+	return utf8.RuneCountInString(string(s))
 }
 
 // Seq of string is a seq of runes
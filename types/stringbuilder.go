@@ -0,0 +1,32 @@
+package types
+
+import (
+	"encoding/binary"
+	"strings"
+	"unsafe"
+)
+
+// StringBuilder - a mutable buffer for building strings incrementally
+type StringBuilder struct {
+	strings.Builder
+}
+
+// NewStringBuilder builds a new empty string builder
+func NewStringBuilder() *StringBuilder {
+	return &StringBuilder{}
+}
+
+// ValueEquals checks pointer equality
+func (sb *StringBuilder) ValueEquals(that MalType) bool {
+	thatBuilder, valid := that.(*StringBuilder)
+	if !valid {
+		return false
+	}
+	return sb == thatBuilder
+}
+
+func (sb *StringBuilder) hashBytes() []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(uintptr(unsafe.Pointer(sb))))
+	return b[:]
+}
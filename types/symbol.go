@@ -1,14 +1,47 @@
 package types
 
-// Symbol - mal symbol values
+import "strings"
+
+// Symbol - mal symbol values. The name of a qualified symbol includes its
+// namespace, e.g. foo/bar.
 type Symbol struct {
-	Name string
-	Meta Map
+	Name      string
+	Namespace string
+	Meta      Map
+	interned  *interned
 }
 
-// NewSymbol builds a new symbol
+// NewSymbol builds a new symbol, qualified if its name has a namespace
 func NewSymbol(name string) Symbol {
-	return Symbol{Name: name}
+	return Symbol{Name: name, Namespace: namespace(name), interned: intern(name)}
+}
+
+// Identical is true if two symbols share an interned name
+func (symbol Symbol) Identical(that Symbol) bool {
+	return symbol.interned != nil && symbol.interned == that.interned
+}
+
+// LocalName is the name of a symbol without its namespace
+func (symbol Symbol) LocalName() string {
+	return localName(symbol.Name, symbol.Namespace)
+}
+
+// namespace returns the part of a qualified name before its first slash, or
+// the empty string if the name is not qualified
+func namespace(name string) string {
+	i := strings.IndexRune(name, '/')
+	if i <= 0 || i == len(name)-1 {
+		return ""
+	}
+	return name[:i]
+}
+
+// localName returns the part of a qualified name after its namespace
+func localName(name string, ns string) string {
+	if ns == "" {
+		return name
+	}
+	return name[len(ns)+1:]
 }
 
 // ValueEquals compares symbols
@@ -17,7 +50,7 @@ func (symbol Symbol) ValueEquals(that MalType) bool {
 	if !valid {
 		return false
 	}
-	return symbol.Name == thatSymbol.Name
+	return symbol.Identical(thatSymbol) || symbol.Name == thatSymbol.Name
 }
 
 func (symbol Symbol) hashBytes() []byte {
@@ -31,5 +64,5 @@ func (symbol Symbol) Metadata() Map {
 
 // WithMetadata symbols
 func (symbol Symbol) WithMetadata(m Map) HasMetadata {
-	return Symbol{Name: symbol.Name, Meta: m}
+	return Symbol{Name: symbol.Name, Namespace: symbol.Namespace, Meta: m, interned: symbol.interned}
 }
@@ -61,24 +61,42 @@ type Indexed interface {
 	Lookup(MalType) (MalType, bool)
 }
 
+// Derefable - a reference whose current value may be read
+type Derefable interface {
+	Deref() (MalType, error)
+}
+
+// Awaitable - a reference whose value may not be available yet, whose Done
+// channel is closed once it is
+type Awaitable interface {
+	Derefable
+	Done() <-chan struct{}
+}
+
+// Realizable - a deferred value which may or may not have been computed yet
+type Realizable interface {
+	Realized() bool
+}
+
+// unboundedHashLength is the number of leading items hashed from unbounded seqs
+const unboundedHashLength = 32
+
 func hashAnyValue(hash *hash.Hash32, value *MalType) {
 	switch cast := (*value).(type) {
 	case HasSimpleValueEquality:
 		(*hash).Write(cast.hashBytes())
 	case Sequential:
+		// Equal sequentials hash equally regardless of their concrete types,
+		// and the delimiters keep nested collections from colliding with
+		// their flattened contents. Unbounded seqs hash only their leading
+		// items.
+		(*hash).Write([]byte("("))
 		seq := cast.Seq()
-		for {
-			empty, head, tail := seq.Next()
-			if empty {
+		for i := 0; ; i++ {
+			if i == unboundedHashLength && Unbounded(seq) {
+				(*hash).Write([]byte("..."))
 				break
 			}
-			hashAnyValue(hash, &head)
-			seq = tail
-		}
-	case Map:
-		(*hash).Write([]byte("{}"))
-		seq := cast.Seq()
-		for {
 			empty, head, tail := seq.Next()
 			if empty {
 				break
@@ -86,12 +104,24 @@ func hashAnyValue(hash *hash.Hash32, value *MalType) {
 			hashAnyValue(hash, &head)
 			seq = tail
 		}
+		(*hash).Write([]byte(")"))
+	case Map:
+		// Entries are hashed in key hash order so equal maps hash equally
+		// regardless of insertion order
+		(*hash).Write([]byte("{"))
+		keys, vals := cast.hashedEntries()
+		for i := range keys {
+			hashAnyValue(hash, &keys[i])
+			hashAnyValue(hash, &vals[i])
+		}
+		(*hash).Write([]byte("}"))
 	default:
 		// TODO hash the pointer address for instance identity
 	}
 }
 
-// Hash computes a murmur3 hash of the given value
+// Hash computes a murmur3 hash of the given value. Values that are Equals
+// must hash equally, since maps rely on it.
 func Hash(value MalType) uint32 {
 	hash := murmur3.New32()
 	hashAnyValue(&hash, &value)
@@ -143,6 +173,12 @@ func Equals(this MalType, that MalType) bool {
 		thisSeq := cast.Seq()
 		thatSeq := thatSequential.Seq()
 		for {
+			// Infinite ranges would never finish comparing item by item
+			if thisRange, valid := infiniteRange(thisSeq); valid {
+				if thatRange, valid := infiniteRange(thatSeq); valid {
+					return thisRange.Lower == thatRange.Lower && thisRange.Step == thatRange.Step
+				}
+			}
 			thisEmpty, thisHead, thisTail := thisSeq.Next()
 			thatEmpty, thatHead, thatTail := thatSeq.Next()
 			if thisEmpty && thatEmpty {
@@ -164,22 +200,27 @@ func Equals(this MalType, that MalType) bool {
 
 // Compare compares values
 func Compare(this MalType, that MalType) (int8, error) {
-	switch cast := this.(type) {
-	case Integer:
-		thatInt, valid := that.(Integer)
-		if !valid {
-			return 0, errors.New("Incomparable values")
-		}
-		delta := cast - thatInt
-		if delta > 0 {
-			return 1, nil
-		} else if delta == 0 {
-			return 0, nil
+	if thisInt, valid := this.(Integer); valid {
+		if thatInt, valid := that.(Integer); valid {
+			switch {
+			case thisInt > thatInt:
+				return 1, nil
+			case thisInt < thatInt:
+				return -1, nil
+			default:
+				return 0, nil
+			}
 		}
-		return -1, nil
-	default:
+	}
+	thisBig, valid := AsBigInt(this)
+	if !valid {
+		return 0, errors.New("Incomparable values")
+	}
+	thatBig, valid := AsBigInt(that)
+	if !valid {
 		return 0, errors.New("Incomparable values")
 	}
+	return int8(thisBig.Cmp(thatBig)), nil
 }
 
 // MalError contains any mal reason
@@ -0,0 +1,104 @@
+package types
+
+import "testing"
+
+func TestEqualValuesHashEqually(t *testing.T) {
+	one, two, three := Integer(1), Integer(2), Integer(3)
+	var entries []MalType
+	for i := 0; i < 2*arrayMapThreshold; i++ {
+		entries = append(entries, Integer(i), String("v"))
+	}
+	var reversed []MalType
+	for i := len(entries) - 2; i >= 0; i -= 2 {
+		reversed = append(reversed, entries[i], entries[i+1])
+	}
+	naturals := Range{Step: 1}
+	tests := []struct {
+		name string
+		a, b MalType
+	}{
+		{"integers", Integer(7), Integer(7)},
+		{"strings", String("abc"), String("abc")},
+		{"runes", Rune('x'), Rune('x')},
+		{"keywords", NewKeyword("ns/k"), NewKeyword("ns/k")},
+		{"symbols", NewSymbol("s"), NewSymbol("s")},
+		{"vectors", NewVector(one, two), NewVector(one, two)},
+		{"a vector and a list", NewVector(one, two), NewList(one, two)},
+		{"a list and a range", NewList(Integer(0), one, two), Range{Upper: 3, Step: 1, Finite: true}},
+		{"a vector and a slice seq", NewVector(one, two), SliceSeq{Items: []MalType{one, two}}},
+		{"a list and a cons", NewList(one, two, three), ConsCell{Head: one, Tail: NewVector(two, three).Seq()}},
+		{"a vector and a concatenation", NewVector(one, two, three), Concatenation{Seqs: []Seq{NewList(one).Seq(), NewList(two, three).Seq()}}},
+		{"empty sequentials", NewVector(), NewList()},
+		{"nested sequentials", NewVector(NewList(one), two), NewList(NewVector(one), two)},
+		{"small maps in different orders", NewMap(one, two, three, one), NewMap(three, one, one, two)},
+		{"large maps in different orders", NewMap(entries...), NewMap(reversed...)},
+		{"nested maps", NewMap(one, NewMap(two, three)), NewMap(one, NewMap(two, three))},
+		{"maps with sequential keys", NewMap(NewVector(one), two), NewMap(NewList(one), two)},
+		{"infinite ranges", naturals, Range{Step: 1}},
+		{"an infinite range and a cons onto one", naturals, ConsCell{Head: Integer(0), Tail: Range{Lower: 1, Step: 1}}},
+		{"an infinite range and a concatenation ending in one", naturals, Concatenation{Seqs: []Seq{
+			NewVector(Integer(0), one).Seq(), Range{Lower: 2, Step: 1},
+		}}},
+		{"nils", Nil{}, Nil{}},
+		{"booleans", Boolean(true), Boolean(true)},
+	}
+	for _, test := range tests {
+		if !Equals(test.a, test.b) || !Equals(test.b, test.a) {
+			t.Errorf("%s: not equal", test.name)
+			continue
+		}
+		if Hash(test.a) != Hash(test.b) {
+			t.Errorf("%s: equal values hash differently", test.name)
+		}
+	}
+}
+
+func TestInfiniteRangesAsMapKeys(t *testing.T) {
+	m := NewMap(Range{Step: 1}, String("naturals"))
+	value, found := m.Lookup(ConsCell{Head: Integer(0), Tail: Range{Lower: 1, Step: 1}})
+	if !found || value != String("naturals") {
+		t.Errorf("lookup by an equal seq found %v", value)
+	}
+	if _, found := m.Lookup(Range{Lower: 1, Step: 1}); found {
+		t.Error("lookup by a different infinite range found a value")
+	}
+	if _, found := m.Lookup(Range{Step: 2}); found {
+		t.Error("lookup by an infinite range of a different step found a value")
+	}
+}
+
+func TestNamedValuesOfDifferentTypesAreDistinct(t *testing.T) {
+	for _, name := range []string{"foo", "ns/foo", ""} {
+		values := []MalType{String(name), NewSymbol(name), NewKeyword(name)}
+		for i, a := range values {
+			m := NewMap(a, Boolean(true))
+			for j, b := range values {
+				if i == j {
+					continue
+				}
+				if Equals(a, b) {
+					t.Errorf("%#v equals %#v", a, b)
+				}
+				if Hash(a) == Hash(b) {
+					t.Errorf("%#v and %#v hash equally", a, b)
+				}
+				if _, found := m.Lookup(b); found {
+					t.Errorf("map keyed by %#v found %#v", a, b)
+				}
+			}
+		}
+	}
+}
+
+func TestRunesAsMapKeys(t *testing.T) {
+	m := NewMap(Rune('a'), Integer(1), Rune('λ'), Integer(2))
+	if value, found := m.Lookup(Rune('λ')); !found || value != Integer(2) {
+		t.Errorf("lookup by an equal rune found %v", value)
+	}
+	if _, found := m.Lookup(String("a")); found {
+		t.Error("lookup by a string of the rune found a value")
+	}
+	if _, found := m.Lookup(Integer('a')); found {
+		t.Error("lookup by the rune's code point found a value")
+	}
+}
@@ -0,0 +1,32 @@
+package types
+
+import (
+	"encoding/binary"
+	"unsafe"
+)
+
+// Volatile - a mutable reference without the synchronization of an atom, for
+// state confined to a single goroutine
+type Volatile struct {
+	Value MalType
+}
+
+// Deref returns the current value of a volatile
+func (v *Volatile) Deref() (MalType, error) {
+	return v.Value, nil
+}
+
+// ValueEquals checks pointer equality
+func (v *Volatile) ValueEquals(that MalType) bool {
+	thatVolatile, valid := that.(*Volatile)
+	if !valid {
+		return false
+	}
+	return v == thatVolatile
+}
+
+func (v *Volatile) hashBytes() []byte {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint64(b, uint64(uintptr(unsafe.Pointer(v))))
+	return b[:]
+}